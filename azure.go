@@ -0,0 +1,80 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// defaultAzureAPIVersion is the Azure OpenAI API version used by default. It
+// is the first GA version that supports every operation WithAzure maps,
+// including image generations.
+const defaultAzureAPIVersion = "2024-02-01"
+
+// ErrUnsupportedOperation is the error returned for calls of operations the
+// API of the client does not support, e.g. moderations on Azure OpenAI. The
+// request is not sent.
+var ErrUnsupportedOperation = errors.New("openai: unsupported operation")
+
+// AzureConfig configures a client of Azure OpenAI.
+type AzureConfig struct {
+	// Endpoint is the endpoint of the Azure OpenAI resource, e.g.
+	// https://my-resource.openai.azure.com.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// APIVersion is the api-version query parameter of the requests. It
+	// defaults to 2024-02-01.
+	APIVersion string `json:"api_version,omitempty" yaml:"api_version,omitempty"`
+	// Deployments maps models to the names of their deployments. Models
+	// without a deployment are sent to the deployment named like the model.
+	// Image generations use the model "dall-e".
+	Deployments map[string]string `json:"deployments,omitempty" yaml:"deployments,omitempty"`
+}
+
+// WithAzure makes the client use Azure OpenAI: requests are sent to the
+// deployment of their model with the API key in the api-key header.
+// Completions, image generations and models are supported; the other
+// operations fail with ErrUnsupportedOperation.
+func WithAzure(config AzureConfig) Option {
+	return func(o *openAI) {
+		if config.APIVersion == "" {
+			config.APIVersion = defaultAzureAPIVersion
+		}
+		o.azure = &config
+		o.baseURL = strings.TrimRight(config.Endpoint, "/")
+	}
+}
+
+// requestURL returns the URL of the request of the call in the context to the
+// path of the OpenAI API.
+func (o *openAI) requestURL(ctx context.Context, path string) (string, error) {
+	if o.azure == nil {
+		return o.baseURL + path, nil
+	}
+	call := callFromContext(ctx)
+	if call == nil {
+		return "", fmt.Errorf("%w: %v on Azure OpenAI", ErrUnsupportedOperation, path)
+	}
+	var azurePath string
+	switch call.Operation {
+	case OperationModels:
+		azurePath = "/openai/models"
+	case OperationCreateCompletion:
+		azurePath = o.azure.deploymentPath(call.Model()) + "/completions"
+	case OperationCreateImage:
+		azurePath = o.azure.deploymentPath(call.Model()) + "/images/generations"
+	default:
+		return "", fmt.Errorf("%w: %v on Azure OpenAI", ErrUnsupportedOperation, call.Operation)
+	}
+	return o.baseURL + azurePath + "?" + url.Values{"api-version": {o.azure.APIVersion}}.Encode(), nil
+}
+
+// deploymentPath returns the path of the deployment of the model.
+func (c *AzureConfig) deploymentPath(model string) string {
+	deployment, ok := c.Deployments[model]
+	if !ok {
+		deployment = model
+	}
+	return "/openai/deployments/" + url.PathEscape(deployment)
+}
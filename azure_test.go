@@ -0,0 +1,82 @@
+package openai_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/noclue/openai"
+)
+
+func TestAzure(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var urls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		urls = append(urls, r.Method+" "+r.URL.String())
+		mu.Unlock()
+		if r.Header.Get("api-key") != "azure-key" || r.Header.Get("Authorization") != "" {
+			t.Errorf("Expected api-key header only, got %v", r.Header)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/openai/models":
+			io.WriteString(w, `{"data": [{"id": "gpt-35-turbo-instruct"}]}`)
+		case "/openai/deployments/davinci-prod/completions":
+			io.WriteString(w, `{"choices": [{"text": "This is a test"}]}`)
+		case "/openai/deployments/dall-e/images/generations":
+			io.WriteString(w, `{"data": [{"url": "https://example.com/image.png"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error": {"code": "404", "message": "Resource not found"}}`)
+		}
+	}))
+	defer server.Close()
+	client := openai.NewOpenAI("azure-key", openai.WithAzure(openai.AzureConfig{
+		Endpoint:    server.URL + "/",
+		Deployments: map[string]string{"text-davinci-003": "davinci-prod"},
+	}))
+	ctx := context.Background()
+
+	if res, err := client.Models(ctx); err != nil || res.Data[0].ID != "gpt-35-turbo-instruct" {
+		t.Errorf("Expected models, got %#v, %#v", res, err)
+	}
+	if res, err := client.CreateCompletion(ctx, openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "Say this is a test"}); err != nil || res.Choices[0].Text != "This is a test" {
+		t.Errorf("Expected completion, got %#v, %#v", res, err)
+	}
+	if res, err := client.CreateImage(ctx, openai.CreateImageReq{Prompt: "A winter forest"}); err != nil || len(res.Data) != 1 {
+		t.Errorf("Expected image, got %#v, %#v", res, err)
+	}
+	var apiErr *openai.APIError
+	if _, err := client.CreateCompletion(ctx, openai.CompletionsRequest{Model: "unknown"}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a model without deployment, got %#v", err)
+	}
+	if _, err := client.Moderation(ctx, openai.ModerationRequest{Input: []string{"a"}}); !errors.Is(err, openai.ErrUnsupportedOperation) {
+		t.Errorf("Expected ErrUnsupportedOperation, got %#v", err)
+	}
+	if _, err := client.Edit(ctx, openai.EditRequest{Input: "a"}); !errors.Is(err, openai.ErrUnsupportedOperation) {
+		t.Errorf("Expected ErrUnsupportedOperation, got %#v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{
+		"GET /openai/models?api-version=2024-02-01",
+		"POST /openai/deployments/davinci-prod/completions?api-version=2024-02-01",
+		"POST /openai/deployments/dall-e/images/generations?api-version=2024-02-01",
+		"POST /openai/deployments/unknown/completions?api-version=2024-02-01",
+	}
+	if len(urls) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, urls)
+	}
+	for i := range want {
+		if urls[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want[i], urls[i])
+		}
+	}
+}
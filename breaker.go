@@ -0,0 +1,254 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults of CircuitBreakerPolicy.
+const (
+	defaultFailureThreshold = 5
+	defaultOpenDuration     = 30 * time.Second
+	defaultHalfOpenRequests = 1
+)
+
+// ErrCircuitOpen is the error returned when a request is refused because the
+// circuit breaker of its endpoint is open. The request is not sent.
+var ErrCircuitOpen = errors.New("openai: circuit breaker open")
+
+// CircuitOpenError describes the open circuit that refused a request. It
+// wraps ErrCircuitOpen.
+type CircuitOpenError struct {
+	// Endpoint is the URL path of the refused request.
+	Endpoint string
+	// Until is the time the circuit starts probing the endpoint again.
+	Until time.Time
+}
+
+// Error returns the error message
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v: %v until %v", ErrCircuitOpen, e.Endpoint, e.Until.Format(time.RFC3339))
+}
+
+// Unwrap returns ErrCircuitOpen.
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// CircuitState is the state of the circuit of an endpoint.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all requests pass.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen refuses all requests.
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe requests pass.
+	CircuitHalfOpen
+)
+
+// String returns the name of the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitBreakerPolicy configures a CircuitBreaker.
+type CircuitBreakerPolicy struct {
+	// FailureThreshold is the number of consecutive failed requests to an
+	// endpoint that open its circuit. It defaults to 5.
+	FailureThreshold int
+	// OpenDuration is the time an open circuit refuses requests before it is
+	// half-open. It defaults to 30 seconds.
+	OpenDuration time.Duration
+	// HalfOpenRequests is the number of concurrent probe requests a half-open
+	// circuit lets pass. It defaults to 1.
+	HalfOpenRequests int
+	// OnStateChange, if set, is called when the circuit of an endpoint
+	// changes its state. It must not block.
+	OnStateChange func(endpoint string, from, to CircuitState)
+}
+
+// CircuitBreaker fails requests to endpoints of the OpenAI API that keep
+// failing fast instead of waiting for them to time out. Requests fail if no
+// response is received, including when their deadline expires, or the
+// response has a 5xx status code; requests canceled by the caller are not
+// counted. The circuit of an endpoint opens
+// after consecutive failures, refuses requests with a *CircuitOpenError for
+// the open duration and then lets probe requests pass. A successful probe
+// closes the circuit and a failed probe opens it again. It is safe for
+// concurrent use and can be shared by clients.
+type CircuitBreaker struct {
+	policy CircuitBreakerPolicy
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+	now      func() time.Time
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+// transition is a state change of the circuit of an endpoint.
+type transition struct {
+	endpoint string
+	from, to CircuitState
+}
+
+// requestOutcome is the outcome of a request passing a circuit breaker.
+type requestOutcome int
+
+const (
+	requestSucceeded requestOutcome = iota
+	requestFailed
+	requestCanceled
+)
+
+// NewCircuitBreaker creates a circuit breaker with the policy.
+func NewCircuitBreaker(policy CircuitBreakerPolicy) *CircuitBreaker {
+	if policy.FailureThreshold <= 0 {
+		policy.FailureThreshold = defaultFailureThreshold
+	}
+	if policy.OpenDuration <= 0 {
+		policy.OpenDuration = defaultOpenDuration
+	}
+	if policy.HalfOpenRequests <= 0 {
+		policy.HalfOpenRequests = defaultHalfOpenRequests
+	}
+	return &CircuitBreaker{
+		policy:   policy,
+		circuits: make(map[string]*circuit),
+		now:      time.Now,
+	}
+}
+
+// WithCircuitBreaker makes the client pass every HTTP request through the
+// circuit breaker.
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return func(o *openAI) {
+		o.breaker = breaker
+	}
+}
+
+// State returns the state of the circuit of the endpoint, e.g.
+// "/v1/completions".
+func (b *CircuitBreaker) State(endpoint string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[endpoint]
+	if !ok {
+		return CircuitClosed
+	}
+	if c.state == CircuitOpen && !b.now().Before(c.openedAt.Add(b.policy.OpenDuration)) {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// allow returns an error if a request to the endpoint must not be sent. A
+// request that is allowed must be reported with done.
+func (b *CircuitBreaker) allow(endpoint string) error {
+	if b == nil {
+		return nil
+	}
+	var changes []transition
+	defer func() { b.notify(changes) }()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[endpoint]
+	if !ok {
+		c = &circuit{}
+		b.circuits[endpoint] = c
+	}
+	if c.state == CircuitOpen {
+		until := c.openedAt.Add(b.policy.OpenDuration)
+		if b.now().Before(until) {
+			return &CircuitOpenError{Endpoint: endpoint, Until: until}
+		}
+		changes = append(changes, c.set(endpoint, CircuitHalfOpen))
+		c.probes = 0
+	}
+	if c.state == CircuitHalfOpen {
+		if c.probes >= b.policy.HalfOpenRequests {
+			return &CircuitOpenError{Endpoint: endpoint, Until: b.now()}
+		}
+		c.probes++
+	}
+	return nil
+}
+
+// done records the outcome of an allowed request to the endpoint.
+func (b *CircuitBreaker) done(endpoint string, outcome requestOutcome) {
+	if b == nil {
+		return
+	}
+	var changes []transition
+	defer func() { b.notify(changes) }()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[endpoint]
+	if c.state == CircuitHalfOpen && c.probes > 0 {
+		c.probes--
+	}
+	switch outcome {
+	case requestSucceeded:
+		c.failures = 0
+		if c.state != CircuitClosed {
+			changes = append(changes, c.set(endpoint, CircuitClosed))
+		}
+	case requestFailed:
+		c.failures++
+		if c.state == CircuitHalfOpen || (c.state == CircuitClosed && c.failures >= b.policy.FailureThreshold) {
+			changes = append(changes, c.set(endpoint, CircuitOpen))
+			c.openedAt = b.now()
+		}
+	}
+}
+
+// set changes the state of the circuit and returns the transition.
+func (c *circuit) set(endpoint string, state CircuitState) transition {
+	t := transition{endpoint: endpoint, from: c.state, to: state}
+	c.state = state
+	return t
+}
+
+// notify reports the transitions to the state change callback.
+func (b *CircuitBreaker) notify(changes []transition) {
+	if b.policy.OnStateChange == nil {
+		return
+	}
+	for _, t := range changes {
+		b.policy.OnStateChange(t.endpoint, t.from, t.to)
+	}
+}
+
+// requestOutcomeOf returns the outcome of a request from its response status
+// code, which is zero if no response was received, and the context error.
+// Requests canceled by the caller are not counted, but requests whose deadline
+// expired count as failures, as a hanging endpoint makes them expire.
+func requestOutcomeOf(status int, ctxErr error) requestOutcome {
+	switch {
+	case status == 0 && errors.Is(ctxErr, context.Canceled):
+		return requestCanceled
+	case status == 0 || status >= http.StatusInternalServerError:
+		return requestFailed
+	default:
+		return requestSucceeded
+	}
+}
@@ -0,0 +1,113 @@
+package openai_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaitest"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+	server := openaitest.NewServer(nil)
+	defer server.Close()
+	var mu sync.Mutex
+	var changes []string
+	breaker := openai.NewCircuitBreaker(openai.CircuitBreakerPolicy{
+		FailureThreshold: 2,
+		OpenDuration:     50 * time.Millisecond,
+		OnStateChange: func(endpoint string, from, to openai.CircuitState) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, fmt.Sprintf("%v %v->%v", endpoint, from, to))
+		},
+	})
+	client := server.OpenAI(openai.WithCircuitBreaker(breaker))
+	ctx := context.Background()
+	overloaded := openaitest.APIError(http.StatusServiceUnavailable, "server_error", "overloaded")
+
+	server.Fake.Fail(openai.OperationEdit, overloaded).Fail(openai.OperationEdit, overloaded).Fail(openai.OperationEdit, overloaded)
+	for i := 0; i < 2; i++ {
+		if _, err := client.Edit(ctx, openai.EditRequest{Input: "a"}); errors.Is(err, openai.ErrCircuitOpen) || err == nil {
+			t.Fatalf("Expected API error, got %#v", err)
+		}
+	}
+	_, err := client.Edit(ctx, openai.EditRequest{Input: "a"})
+	var openErr *openai.CircuitOpenError
+	if !errors.As(err, &openErr) || openErr.Endpoint != "/v1/edits" {
+		t.Fatalf("Expected open circuit error, got %#v", err)
+	}
+	server.Fake.AssertCalled(t, openai.OperationEdit, 2)
+	if _, err := client.Models(ctx); err != nil {
+		t.Errorf("Expected other endpoints to pass, got %#v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if state := breaker.State("/v1/edits"); state != openai.CircuitHalfOpen {
+		t.Errorf("Expected half-open circuit, got %v", state)
+	}
+	if _, err := client.Edit(ctx, openai.EditRequest{Input: "a"}); err == nil || errors.Is(err, openai.ErrCircuitOpen) {
+		t.Fatalf("Expected failed probe, got %#v", err)
+	}
+	if _, err := client.Edit(ctx, openai.EditRequest{Input: "a"}); !errors.Is(err, openai.ErrCircuitOpen) {
+		t.Fatalf("Expected reopened circuit, got %#v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := client.Edit(ctx, openai.EditRequest{Input: "a"}); err != nil {
+		t.Fatalf("Expected successful probe, got %#v", err)
+	}
+	if state := breaker.State("/v1/edits"); state != openai.CircuitClosed {
+		t.Errorf("Expected closed circuit, got %v", state)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{
+		"/v1/edits closed->open",
+		"/v1/edits open->half-open",
+		"/v1/edits half-open->open",
+		"/v1/edits open->half-open",
+		"/v1/edits half-open->closed",
+	}
+	if fmt.Sprint(changes) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, changes)
+	}
+}
+
+func TestCircuitBreakerIgnoresCanceledRequests(t *testing.T) {
+	t.Parallel()
+	server := openaitest.NewServer(openaitest.NewFake().SetLatency(time.Hour))
+	defer server.Close()
+	breaker := openai.NewCircuitBreaker(openai.CircuitBreakerPolicy{FailureThreshold: 1})
+	client := server.OpenAI(openai.WithCircuitBreaker(breaker))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := client.Models(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected canceled error, got %#v", err)
+	}
+	if state := breaker.State("/v1/models"); state != openai.CircuitClosed {
+		t.Errorf("Expected closed circuit, got %v", state)
+	}
+}
+
+func TestCircuitBreakerCountsTimeouts(t *testing.T) {
+	t.Parallel()
+	server := openaitest.NewServer(openaitest.NewFake().SetLatency(time.Hour))
+	defer server.Close()
+	breaker := openai.NewCircuitBreaker(openai.CircuitBreakerPolicy{FailureThreshold: 1})
+	client := server.OpenAI(openai.WithCircuitBreaker(breaker))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.Models(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline error, got %#v", err)
+	}
+	if state := breaker.State("/v1/models"); state != openai.CircuitOpen {
+		t.Errorf("Expected open circuit, got %v", state)
+	}
+}
@@ -0,0 +1,484 @@
+package openai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BudgetScope is what a budget applies to.
+type BudgetScope string
+
+const (
+	// BudgetScopeGlobal budgets apply to all requests.
+	BudgetScopeGlobal BudgetScope = "global"
+	// BudgetScopeUser budgets apply to requests with the User field set.
+	BudgetScopeUser BudgetScope = "user"
+	// BudgetScopeAPIKey budgets apply to requests made with an API key.
+	BudgetScopeAPIKey BudgetScope = "api_key"
+)
+
+// BudgetPeriod is the period after which a budget's spend is reset.
+type BudgetPeriod string
+
+const (
+	// Daily budgets reset at midnight UTC.
+	Daily BudgetPeriod = "daily"
+	// Monthly budgets reset at midnight UTC on the first day of the month.
+	Monthly BudgetPeriod = "monthly"
+)
+
+// keyFingerprintPrefix marks API keys that have been replaced by their
+// fingerprint.
+const keyFingerprintPrefix = "sha256:"
+
+// Budget is a spending limit.
+type Budget struct {
+	// Name identifies the budget. It must be unique within a tracker.
+	Name string `json:"name" yaml:"name"`
+	// Scope is what the budget applies to.
+	Scope BudgetScope `json:"scope" yaml:"scope"`
+	// Key is the user for BudgetScopeUser budgets or the API key for
+	// BudgetScopeAPIKey budgets. An empty key gives every user or API key an
+	// allowance of its own. API keys are never persisted; they are replaced
+	// by their fingerprint.
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+	// Period is the period after which the spend is reset.
+	Period BudgetPeriod `json:"period" yaml:"period"`
+	// MaxCost is the limit in US dollars. Zero means no limit. Requests
+	// estimated to cost nothing, e.g. moderations, are allowed even once the
+	// limit is reached. Requests to models missing from the tracker's price
+	// table are refused with an *UnknownPriceError, since their cost cannot be
+	// estimated.
+	MaxCost float64 `json:"max_cost_usd,omitempty" yaml:"max_cost_usd,omitempty"`
+	// MaxTokens is the limit in tokens. Zero means no limit. Requests
+	// estimated to use no tokens, e.g. image requests, are allowed even once
+	// the limit is reached.
+	MaxTokens int64 `json:"max_tokens,omitempty" yaml:"max_tokens,omitempty"`
+}
+
+// subject returns the subject the budget accounts the request to and whether
+// the budget applies to it.
+func (b Budget) subject(apiKey string, rec UsageRecord) (string, bool) {
+	switch b.Scope {
+	case BudgetScopeGlobal:
+		return "", true
+	case BudgetScopeUser:
+		if rec.User == "" || (b.Key != "" && b.Key != rec.User) {
+			return "", false
+		}
+		return rec.User, true
+	case BudgetScopeAPIKey:
+		fingerprint := keyFingerprint(apiKey)
+		if b.Key != "" && b.Key != fingerprint {
+			return "", false
+		}
+		return fingerprint, true
+	default:
+		return "", false
+	}
+}
+
+// periodStart returns the start of the budget period that contains t.
+func (b Budget) periodStart(t time.Time) time.Time {
+	t = t.UTC()
+	if b.Period == Monthly {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (b Budget) validate() error {
+	if b.Name == "" {
+		return errors.New("openai: budget name is required")
+	}
+	switch b.Scope {
+	case BudgetScopeGlobal, BudgetScopeUser, BudgetScopeAPIKey:
+	default:
+		return fmt.Errorf("openai: budget %v has invalid scope: %q", b.Name, b.Scope)
+	}
+	switch b.Period {
+	case Daily, Monthly:
+	default:
+		return fmt.Errorf("openai: budget %v has invalid period: %q", b.Name, b.Period)
+	}
+	return nil
+}
+
+// keyFingerprint returns a stable identifier of an API key that can be stored
+// without revealing the key.
+func keyFingerprint(apiKey string) string {
+	if strings.HasPrefix(apiKey, keyFingerprintPrefix) {
+		return apiKey
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return keyFingerprintPrefix + hex.EncodeToString(sum[:8])
+}
+
+// BudgetStatus is the spend of a subject against a budget in the current
+// period.
+type BudgetStatus struct {
+	// Budget is the name of the budget.
+	Budget string `json:"budget" yaml:"budget"`
+	// Subject is the user or API key fingerprint the spend is accounted to.
+	// It is empty for global budgets.
+	Subject string `json:"subject,omitempty" yaml:"subject,omitempty"`
+	// PeriodStart is the start of the current budget period.
+	PeriodStart time.Time `json:"period_start" yaml:"period_start"`
+	// Cost is the spend in US dollars.
+	Cost float64 `json:"cost_usd" yaml:"cost_usd"`
+	// Tokens is the number of tokens used.
+	Tokens int64 `json:"tokens" yaml:"tokens"`
+
+	// reservedCost and reservedTokens are the estimated spend of the requests
+	// checked but not yet recorded.
+	reservedCost   float64
+	reservedTokens int64
+	// unsavedCost and unsavedTokens are the spend recorded but not yet
+	// persisted to the budget file.
+	unsavedCost   float64
+	unsavedTokens int64
+}
+
+// budgetFile is the on-disk format of a budget tracker.
+type budgetFile struct {
+	Budgets []Budget       `json:"budgets"`
+	Spend   []BudgetStatus `json:"spend"`
+}
+
+// BudgetTracker enforces spending budgets. Spend is persisted to a file after
+// every request so budgets survive restarts. It is safe for concurrent use,
+// and the budget file may be shared by trackers of several processes with the
+// same budgets: the file is locked with a lock file next to it, path+".lock",
+// while spend is recorded, and the spend recorded by the other processes is
+// reloaded before requests are checked. Estimates reserved by Check are only
+// counted by the tracker that reserved them. Attach it to a client with
+// WithBudgetTracker.
+type BudgetTracker struct {
+	mu      sync.Mutex
+	path    string
+	pricing Pricing
+	budgets []Budget
+	spend   map[string]*BudgetStatus
+	now     func() time.Time
+}
+
+// NewBudgetTracker creates a budget tracker persisted to the file at path. The
+// spend recorded in the file is loaded if it exists. If budgets are given they
+// replace the budgets stored in the file, otherwise the stored budgets are
+// used.
+func NewBudgetTracker(path string, pricing Pricing, budgets ...Budget) (*BudgetTracker, error) {
+	t := &BudgetTracker{
+		path:    path,
+		pricing: pricing,
+		spend:   map[string]*BudgetStatus{},
+		now:     time.Now,
+	}
+	unlock, err := lockFile(t.lockPath())
+	if err != nil {
+		return nil, fmt.Errorf("openai: budget file lock error: %w", err)
+	}
+	defer unlock()
+	stored, err := t.load()
+	if err != nil {
+		return nil, err
+	}
+	if len(budgets) == 0 {
+		budgets = stored.Budgets
+	}
+	names := map[string]bool{}
+	for _, b := range budgets {
+		if err := b.validate(); err != nil {
+			return nil, err
+		}
+		if names[b.Name] {
+			return nil, fmt.Errorf("openai: duplicate budget name: %v", b.Name)
+		}
+		names[b.Name] = true
+		if b.Scope == BudgetScopeAPIKey && b.Key != "" {
+			b.Key = keyFingerprint(b.Key)
+		}
+		t.budgets = append(t.budgets, b)
+	}
+	for i := range stored.Spend {
+		s := stored.Spend[i]
+		if names[s.Budget] {
+			t.spend[spendKey(s.Budget, s.Subject)] = &s
+		}
+	}
+	if len(budgets) > 0 || len(stored.Budgets) > 0 {
+		if err := t.save(); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func spendKey(budget, subject string) string {
+	return budget + "\x00" + subject
+}
+
+// lockPath returns the path of the lock file of the budget file.
+func (t *BudgetTracker) lockPath() string {
+	return t.path + ".lock"
+}
+
+// load reads the budget file. It returns an empty file if it does not exist.
+func (t *BudgetTracker) load() (budgetFile, error) {
+	var stored budgetFile
+	data, err := os.ReadFile(t.path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return stored, fmt.Errorf("openai: budget file decoding error: %w", err)
+		}
+	case !os.IsNotExist(err):
+		return stored, fmt.Errorf("openai: budget file read error: %w", err)
+	}
+	return stored, nil
+}
+
+// reload updates the spend with the spend stored in the budget file, which
+// includes the spend recorded by other processes sharing it. The estimates
+// reserved by the tracker and the spend it failed to persist are kept. The
+// caller must hold t.mu.
+func (t *BudgetTracker) reload() error {
+	stored, err := t.load()
+	if err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, b := range t.budgets {
+		names[b.Name] = true
+	}
+	for i := range stored.Spend {
+		f := stored.Spend[i]
+		if !names[f.Budget] {
+			continue
+		}
+		key := spendKey(f.Budget, f.Subject)
+		switch s, ok := t.spend[key]; {
+		case !ok || f.PeriodStart.After(s.PeriodStart):
+			t.spend[key] = &f
+		case f.PeriodStart.Equal(s.PeriodStart):
+			s.Cost, s.Tokens = f.Cost+s.unsavedCost, f.Tokens+s.unsavedTokens
+		}
+	}
+	return nil
+}
+
+// current returns the spend of the subject in the current period of the
+// budget. The caller must hold t.mu.
+func (t *BudgetTracker) current(b Budget, subject string) *BudgetStatus {
+	start := b.periodStart(t.now())
+	key := spendKey(b.Name, subject)
+	s, ok := t.spend[key]
+	if !ok || !s.PeriodStart.Equal(start) {
+		s = &BudgetStatus{Budget: b.Name, Subject: subject, PeriodStart: start}
+		t.spend[key] = s
+	}
+	return s
+}
+
+// Check returns a *BudgetExceededError if making a request with the estimated
+// usage would exceed a budget, or an *UnknownPriceError if a budget limits
+// cost and the price table has no price for the request. It counts the
+// estimates of the requests checked but not yet recorded. Otherwise it
+// reserves the estimated usage until the returned reservation is recorded or
+// released, so concurrent requests cannot all pass the check against the same
+// spend.
+func (t *BudgetTracker) Check(apiKey string, estimate UsageRecord) (*BudgetReservation, error) {
+	cost := t.pricing.Cost(estimate)
+	priced := t.pricing.priced(estimate)
+	tokens := int64(estimate.Usage.TotalTokens)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+	var spend []*BudgetStatus
+	for _, b := range t.budgets {
+		subject, ok := b.subject(apiKey, estimate)
+		if !ok {
+			continue
+		}
+		if b.MaxCost > 0 && !priced {
+			priceErr := &UnknownPriceError{Budget: b.Name, Model: estimate.Model}
+			if estimate.Images > 0 {
+				priceErr.Size = imageSize(estimate.ImageSize)
+			}
+			return nil, priceErr
+		}
+		s := t.current(b, subject)
+		spent := s.Cost + s.reservedCost
+		if b.MaxCost > 0 && cost > 0 && spent+cost > b.MaxCost {
+			return nil, &BudgetExceededError{Budget: b.Name, Subject: subject, Limit: b.MaxCost, Spent: spent, Requested: cost, Unit: "usd"}
+		}
+		spentTokens := s.Tokens + s.reservedTokens
+		if b.MaxTokens > 0 && tokens > 0 && spentTokens+tokens > b.MaxTokens {
+			return nil, &BudgetExceededError{Budget: b.Name, Subject: subject, Limit: float64(b.MaxTokens), Spent: float64(spentTokens), Requested: float64(tokens), Unit: "tokens"}
+		}
+		spend = append(spend, s)
+	}
+	for _, s := range spend {
+		s.reservedCost += cost
+		s.reservedTokens += tokens
+	}
+	return &BudgetReservation{tracker: t, apiKey: apiKey, spend: spend, cost: cost, tokens: tokens}, nil
+}
+
+// Record adds the actual usage of a request to the spend of every budget it
+// applies to and persists the spend, merged with the spend recorded by other
+// processes sharing the budget file. The in-memory spend is updated even if
+// persisting fails.
+func (t *BudgetTracker) Record(apiKey string, rec UsageRecord) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.record(apiKey, rec)
+}
+
+// record adds the usage to the spend and persists it. The budget file is
+// locked and reloaded first, so that the spend recorded by other processes
+// in the meantime is not overwritten. The caller must hold t.mu.
+func (t *BudgetTracker) record(apiKey string, rec UsageRecord) error {
+	unlock, lockErr := lockFile(t.lockPath())
+	var err error
+	if lockErr != nil {
+		err = fmt.Errorf("openai: budget file lock error: %w", lockErr)
+	} else {
+		defer unlock()
+		err = t.reload()
+	}
+	cost := t.pricing.Cost(rec)
+	for _, b := range t.budgets {
+		subject, ok := b.subject(apiKey, rec)
+		if !ok {
+			continue
+		}
+		s := t.current(b, subject)
+		s.Cost += cost
+		s.Tokens += int64(rec.Usage.TotalTokens)
+		s.unsavedCost += cost
+		s.unsavedTokens += int64(rec.Usage.TotalTokens)
+	}
+	if err != nil {
+		return err
+	}
+	return t.save()
+}
+
+// BudgetReservation is the estimated usage of a request reserved by
+// BudgetTracker.Check. It must be either recorded once the request succeeds
+// or released if it fails.
+type BudgetReservation struct {
+	tracker *BudgetTracker
+	apiKey  string
+	spend   []*BudgetStatus
+	cost    float64
+	tokens  int64
+	done    bool
+}
+
+// Record replaces the reserved estimate with the actual usage of the request
+// and persists the spend, as BudgetTracker.Record. Recording or releasing a
+// reservation again has no effect.
+func (r *BudgetReservation) Record(rec UsageRecord) error {
+	t := r.tracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !r.release() {
+		return nil
+	}
+	return t.record(r.apiKey, rec)
+}
+
+// Release returns the reserved estimate of a request that was not made or
+// failed.
+func (r *BudgetReservation) Release() {
+	t := r.tracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r.release()
+}
+
+// release returns the reserved estimate and reports whether it was still
+// reserved. The caller must hold the tracker's mutex.
+func (r *BudgetReservation) release() bool {
+	if r.done {
+		return false
+	}
+	r.done = true
+	for _, s := range r.spend {
+		s.reservedCost -= r.cost
+		s.reservedTokens -= r.tokens
+	}
+	return true
+}
+
+// Status returns the spend in the current period of every budget and subject
+// seen so far, in the order of the budgets and then by subject.
+func (t *BudgetTracker) Status() []BudgetStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var res []BudgetStatus
+	for _, b := range t.budgets {
+		start := b.periodStart(t.now())
+		n := len(res)
+		for _, s := range t.spend {
+			if s.Budget == b.Name && s.PeriodStart.Equal(start) {
+				res = append(res, *s)
+			}
+		}
+		sort.Slice(res[n:], func(i, j int) bool {
+			return res[n+i].Subject < res[n+j].Subject
+		})
+	}
+	return res
+}
+
+// Budgets returns the budgets enforced by the tracker.
+func (t *BudgetTracker) Budgets() []Budget {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Budget(nil), t.budgets...)
+}
+
+// save writes the budgets and spend to the budget file. The caller must hold
+// t.mu and the lock of the budget file.
+func (t *BudgetTracker) save() error {
+	f := budgetFile{Budgets: t.budgets}
+	for _, s := range t.spend {
+		f.Spend = append(f.Spend, *s)
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("openai: budget file encoding error: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(t.path), filepath.Base(t.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("openai: budget file write error: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("openai: budget file write error: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("openai: budget file write error: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), t.path); err != nil {
+		return fmt.Errorf("openai: budget file write error: %w", err)
+	}
+	for _, s := range t.spend {
+		s.unsavedCost, s.unsavedTokens = 0, 0
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package openai_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/noclue/openai"
+)
+
+func TestBudgetTracker(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "budgets.json")
+	budgets := []openai.Budget{
+		{Name: "daily", Scope: openai.BudgetScopeGlobal, Period: openai.Daily, MaxCost: 0.04},
+		{Name: "per-key", Scope: openai.BudgetScopeAPIKey, Key: apiKey, Period: openai.Monthly, MaxTokens: 100000},
+	}
+	tracker, err := openai.NewBudgetTracker(path, openai.DefaultPricing, budgets...)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+
+	sent := 0
+	httpClient := &mockHttpClient{
+		response:         jsonResponse(http.StatusOK, completionsSuccessResponse),
+		requestValidator: func(*http.Request) { sent++ },
+	}
+	c := openai.NewOpenAI(apiKey, openai.WithHttpClient(httpClient), openai.WithBudgetTracker(tracker))
+	req := openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "blah-blah"}
+	if _, err := c.CreateCompletion(context.Background(), req); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+
+	_, err = c.CreateCompletion(context.Background(), req)
+	if !errors.Is(err, openai.ErrBudgetExceeded) {
+		t.Fatalf("Expected ErrBudgetExceeded, got %#v", err)
+	}
+	var budgetErr *openai.BudgetExceededError
+	if !errors.As(err, &budgetErr) || budgetErr.Budget != "daily" {
+		t.Errorf("Expected BudgetExceededError for daily budget, got %#v", err)
+	}
+	if sent != 1 {
+		t.Errorf("Expected 1 request sent, got %d", sent)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if strings.Contains(string(data), apiKey) {
+		t.Error("Expected API key not to be persisted")
+	}
+
+	// Budgets and spend are reloaded from the file.
+	reloaded, err := openai.NewBudgetTracker(path, openai.DefaultPricing)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if len(reloaded.Budgets()) != 2 {
+		t.Errorf("Expected 2 budgets, got %d", len(reloaded.Budgets()))
+	}
+	for _, s := range reloaded.Status() {
+		if s.Tokens != 2000 {
+			t.Errorf("Expected 2000 tokens spent on %v, got %d", s.Budget, s.Tokens)
+		}
+	}
+	priced := openai.UsageRecord{Model: "text-davinci-003", Usage: openai.Usage{PropmtTokens: 1, TotalTokens: 1}}
+	_, err = reloaded.Check(apiKey, priced)
+	if !errors.Is(err, openai.ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded after reload, got %#v", err)
+	}
+	if _, err := reloaded.Check("sk-other", priced); !errors.Is(err, openai.ErrBudgetExceeded) {
+		t.Errorf("Expected global budget to apply to other keys, got %#v", err)
+	}
+	// Requests that cost nothing, like moderations, are not refused by a
+	// spent cost budget.
+	if _, err := reloaded.Check(apiKey, openai.UsageRecord{Model: "text-moderation-latest"}); err != nil {
+		t.Errorf("Expected nil for a free request, got %#v", err)
+	}
+}
+
+func TestBudgetTrackerSharedFile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "budgets.json")
+	budget := openai.Budget{Name: "tokens", Scope: openai.BudgetScopeGlobal, Period: openai.Daily, MaxTokens: 1000}
+	// The trackers stand for processes sharing the budget file.
+	first, err := openai.NewBudgetTracker(path, openai.DefaultPricing, budget)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	second, err := openai.NewBudgetTracker(path, openai.DefaultPricing, budget)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	var wg sync.WaitGroup
+	for _, tracker := range []*openai.BudgetTracker{first, second, first, second} {
+		wg.Add(1)
+		go func(tracker *openai.BudgetTracker) {
+			defer wg.Done()
+			if err := tracker.Record(apiKey, openai.UsageRecord{Usage: openai.Usage{TotalTokens: 200}}); err != nil {
+				t.Errorf("Expected nil, got %#v", err)
+			}
+		}(tracker)
+	}
+	wg.Wait()
+
+	if _, err := first.Check(apiKey, openai.UsageRecord{Usage: openai.Usage{TotalTokens: 201}}); !errors.Is(err, openai.ErrBudgetExceeded) {
+		t.Errorf("Expected the spend of both trackers to be counted, got %#v", err)
+	}
+	reloaded, err := openai.NewBudgetTracker(path, openai.DefaultPricing)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if status := reloaded.Status(); len(status) != 1 || status[0].Tokens != 800 {
+		t.Errorf("Expected 800 tokens spent, got %#v", status)
+	}
+}
+
+func TestBudgetTrackerUnsavedSpend(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "budgets.json")
+	tracker, err := openai.NewBudgetTracker(path, openai.DefaultPricing,
+		openai.Budget{Name: "tokens", Scope: openai.BudgetScopeGlobal, Period: openai.Daily, MaxTokens: 1000})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	usage := openai.UsageRecord{Usage: openai.Usage{TotalTokens: 600}}
+	if err := tracker.Record(apiKey, usage); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	// A directory in place of the lock file makes saving fail.
+	if err := os.Remove(path + ".lock"); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if err := os.Mkdir(path+".lock", 0700); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if err := tracker.Record(apiKey, usage); err == nil {
+		t.Fatal("Expected error saving the spend, got nil")
+	}
+	if _, err := tracker.Check(apiKey, openai.UsageRecord{Usage: openai.Usage{TotalTokens: 300}}); !errors.Is(err, openai.ErrBudgetExceeded) {
+		t.Errorf("Expected the unsaved spend to be counted after reload, got %#v", err)
+	}
+
+	// The unsaved spend is persisted with the next record.
+	if err := os.Remove(path + ".lock"); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if err := tracker.Record(apiKey, openai.UsageRecord{}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	reloaded, err := openai.NewBudgetTracker(path, openai.DefaultPricing)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if status := reloaded.Status(); len(status) != 1 || status[0].Tokens != 1200 {
+		t.Errorf("Expected 1200 tokens spent, got %#v", status)
+	}
+}
+
+func TestBudgetTrackerPerUser(t *testing.T) {
+	t.Parallel()
+	tracker, err := openai.NewBudgetTracker(filepath.Join(t.TempDir(), "budgets.json"), openai.DefaultPricing,
+		openai.Budget{Name: "users", Scope: openai.BudgetScopeUser, Period: openai.Daily, MaxTokens: 1000})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if err := tracker.Record(apiKey, openai.UsageRecord{User: "alice", Usage: openai.Usage{TotalTokens: 1000}}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if _, err := tracker.Check(apiKey, openai.UsageRecord{User: "alice", Usage: openai.Usage{TotalTokens: 1}}); !errors.Is(err, openai.ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded for alice, got %#v", err)
+	}
+	// Requests that use no tokens are not refused by a spent token budget,
+	// as requests that cost nothing are not by a spent cost budget.
+	if _, err := tracker.Check(apiKey, openai.UsageRecord{User: "alice"}); err != nil {
+		t.Errorf("Expected nil for a request without tokens, got %#v", err)
+	}
+	if _, err := tracker.Check(apiKey, openai.UsageRecord{User: "bob", Usage: openai.Usage{TotalTokens: 1000}}); err != nil {
+		t.Errorf("Expected nil for bob, got %#v", err)
+	}
+	if _, err := tracker.Check(apiKey, openai.UsageRecord{User: "bob", Usage: openai.Usage{TotalTokens: 1001}}); !errors.Is(err, openai.ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded for oversized request, got %#v", err)
+	}
+	for _, user := range []string{"dave", "carol"} {
+		if err := tracker.Record(apiKey, openai.UsageRecord{User: user, Usage: openai.Usage{TotalTokens: 10}}); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+	}
+	var subjects []string
+	for _, s := range tracker.Status() {
+		subjects = append(subjects, s.Subject)
+	}
+	if got := strings.Join(subjects, ","); got != "alice,bob,carol,dave" {
+		t.Errorf("Expected the status sorted by subject, got %v", got)
+	}
+}
+
+func TestBudgetTrackerReservations(t *testing.T) {
+	t.Parallel()
+	tracker, err := openai.NewBudgetTracker(filepath.Join(t.TempDir(), "budgets.json"), openai.DefaultPricing,
+		openai.Budget{Name: "tokens", Scope: openai.BudgetScopeGlobal, Period: openai.Daily, MaxTokens: 1000})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	estimate := openai.UsageRecord{Usage: openai.Usage{TotalTokens: 600}}
+	first, err := tracker.Check(apiKey, estimate)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	// The estimate of the first request is reserved until it is recorded.
+	if _, err := tracker.Check(apiKey, estimate); !errors.Is(err, openai.ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded while reserved, got %#v", err)
+	}
+	first.Release()
+	second, err := tracker.Check(apiKey, estimate)
+	if err != nil {
+		t.Fatalf("Expected nil after release, got %#v", err)
+	}
+	if err := second.Record(openai.UsageRecord{Usage: openai.Usage{TotalTokens: 100}}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	second.Release()
+	if status := tracker.Status(); len(status) != 1 || status[0].Tokens != 100 {
+		t.Errorf("Expected 100 tokens spent, got %#v", status)
+	}
+	if _, err := tracker.Check(apiKey, openai.UsageRecord{Usage: openai.Usage{TotalTokens: 900}}); err != nil {
+		t.Errorf("Expected the settled reservation to free the estimate, got %#v", err)
+	}
+}
+
+func TestBudgetTrackerUnknownPrice(t *testing.T) {
+	t.Parallel()
+	tracker, err := openai.NewBudgetTracker(filepath.Join(t.TempDir(), "budgets.json"), openai.DefaultPricing,
+		openai.Budget{Name: "cost", Scope: openai.BudgetScopeUser, Key: "alice", Period: openai.Daily, MaxCost: 1},
+		openai.Budget{Name: "tokens", Scope: openai.BudgetScopeGlobal, Period: openai.Daily, MaxTokens: 1000})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	unknown := openai.UsageRecord{Model: "text-davinci-004", User: "alice", Usage: openai.Usage{TotalTokens: 10}}
+	_, err = tracker.Check(apiKey, unknown)
+	var priceErr *openai.UnknownPriceError
+	if !errors.As(err, &priceErr) || priceErr.Budget != "cost" || priceErr.Model != "text-davinci-004" {
+		t.Errorf("Expected UnknownPriceError for the cost budget, got %#v", err)
+	}
+	if !errors.Is(err, openai.ErrUnknownPrice) {
+		t.Errorf("Expected ErrUnknownPrice, got %#v", err)
+	}
+	// Budgets without a cost limit do not need a price.
+	unknown.User = "bob"
+	if _, err := tracker.Check(apiKey, unknown); err != nil {
+		t.Errorf("Expected nil without a cost budget, got %#v", err)
+	}
+	for _, rec := range []openai.UsageRecord{
+		{Model: "curie:ft-acme-2023", User: "alice"},
+		{User: "alice"},
+		{Model: "dall-e", User: "alice", Images: 1, ImageSize: openai.SmallImage},
+	} {
+		if _, err := tracker.Check(apiKey, rec); err != nil {
+			t.Errorf("Expected nil for priced %#v, got %#v", rec, err)
+		}
+	}
+	_, err = tracker.Check(apiKey, openai.UsageRecord{Model: "dall-e", User: "alice", Images: 1, ImageSize: "2048x2048"})
+	if !errors.As(err, &priceErr) || priceErr.Size != "2048x2048" || !strings.Contains(err.Error(), `image size "2048x2048"`) {
+		t.Errorf("Expected UnknownPriceError for unpriced image size, got %#v", err)
+	}
+}
+
+func TestNewBudgetTrackerInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := openai.NewBudgetTracker(filepath.Join(t.TempDir(), "budgets.json"), openai.DefaultPricing,
+		openai.Budget{Name: "bad", Scope: openai.BudgetScopeGlobal, Period: "weekly"})
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
@@ -0,0 +1,255 @@
+package openai
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CacheStore stores cached responses. Implementations must be safe for
+// concurrent use.
+type CacheStore interface {
+	// Get returns the value stored for the key and whether it was found.
+	// Expired values are not found.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores the value for the key. It expires after ttl, or never if ttl
+	// is zero.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// WithCache caches the responses of cacheable calls in store for ttl, or until
+// the store evicts them if ttl is zero. Completions and edits are cacheable
+// if their temperature is 0 and they do not stream; moderations are always
+// cacheable. Responses are keyed by a hash of the endpoint, the request JSON
+// and the account the request is sent with, so calls with different API keys,
+// organizations, projects or headers, set on the client or per request, do
+// not share responses. Calls sharing a key pool do. Calls answered from the
+// cache have Call.CacheHit and ResponseMetadata.CacheHit set and are neither
+// sent, logged, charged nor recorded. Cacheable calls have
+// ResponseMetadata.Cacheable set. Store errors are treated as cache misses.
+func WithCache(store CacheStore, ttl time.Duration) Option {
+	return func(o *openAI) {
+		o.cache = store
+		o.cacheTTL = ttl
+	}
+}
+
+// cacheKey returns the cache key of the call in the account scope and whether
+// the call is cacheable.
+func cacheKey(call *Call, scope string) (string, bool) {
+	var endpoint string
+	switch req := call.Request.(type) {
+	case *CompletionsRequest:
+		if !deterministic(req.Temperature, req.Stream) {
+			return "", false
+		}
+		endpoint = completionsPath
+	case *EditRequest:
+		if !deterministic(req.Temperature, nil) {
+			return "", false
+		}
+		endpoint = createEditPath
+	case *ModerationRequest:
+		endpoint = moderationPath
+	default:
+		return "", false
+	}
+	body, err := json.Marshal(call.Request)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(append([]byte(endpoint+"\n"+scope+"\n"), body...))
+	return hex.EncodeToString(sum[:]), true
+}
+
+// deterministic reports whether a request with the temperature and stream
+// parameters always gets the same response.
+func deterministic(temperature *float64, stream *bool) bool {
+	return temperature != nil && *temperature == 0 && (stream == nil || !*stream)
+}
+
+// caching answers cacheable calls from the client's cache and stores the
+// responses of the calls it passes on.
+func (o *openAI) caching(next Handler) Handler {
+	return func(ctx context.Context, call *Call) error {
+		scope, err := o.accountScope(ctx, call)
+		if err != nil {
+			return err
+		}
+		key, ok := cacheKey(call, scope)
+		if !ok {
+			return next(ctx, call)
+		}
+		call.cacheable = true
+		if value, ok, err := o.cache.Get(ctx, key); err == nil && ok {
+			if err := json.Unmarshal(value, call.Response); err == nil {
+				call.CacheHit = true
+				return nil
+			}
+		}
+		if err := next(ctx, call); err != nil {
+			return err
+		}
+		if value, err := json.Marshal(call.Response); err == nil {
+			o.cache.Set(ctx, key, value, o.cacheTTL)
+		}
+		return nil
+	}
+}
+
+// MemoryCache is an in-memory CacheStore that evicts the least recently used
+// values once it holds its maximum number of values.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache creates a cache holding up to maxEntries values, or any
+// number of values if maxEntries is zero.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Get implements CacheStore.
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.lru.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+// Set implements CacheStore.
+func (c *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &memoryEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return nil
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	if c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of stored values, including expired values that
+// have not been evicted yet.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// DiskCache is a CacheStore keeping every value in a file of its directory,
+// so cached responses survive restarts and can be shared between processes.
+// Expired values are removed when they are read.
+type DiskCache struct {
+	dir string
+}
+
+// diskEntry is the content of a file of a DiskCache.
+type diskEntry struct {
+	Expires time.Time `json:"expires,omitempty"`
+	Value   []byte    `json:"value"`
+}
+
+// NewDiskCache creates a cache in dir, creating the directory if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// path returns the path of the file of the key. Keys are hashed, so any key
+// is a valid file name.
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get implements CacheStore.
+func (c *DiskCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var entry diskEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, err
+	}
+	if !entry.Expires.IsZero() && time.Now().After(entry.Expires) {
+		os.Remove(path)
+		return nil, false, nil
+	}
+	return entry.Value, true, nil
+}
+
+// Set implements CacheStore. The value is written to a temporary file that
+// replaces the file of the key, so readers never see partial values.
+func (c *DiskCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := diskEntry{Value: value}
+	if ttl > 0 {
+		entry.Expires = time.Now().Add(ttl)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(c.dir, "entry-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.path(key))
+}
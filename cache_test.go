@@ -0,0 +1,121 @@
+package openai_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaitest"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+	server := openaitest.NewServer(nil)
+	defer server.Close()
+	accountant := openai.NewUsageAccountant(openai.DefaultPricing)
+	client := server.OpenAI(openai.WithCache(openai.NewMemoryCache(10), time.Hour), openai.WithUsageAccountant(accountant))
+	zero, one := 0.0, 1.0
+
+	for i := 0; i < 2; i++ {
+		ctx, md := openai.WithResponseMetadata(context.Background())
+		res, err := client.CreateCompletion(ctx, openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "Say this is a test", Temperature: &zero})
+		if err != nil || res.Choices[0].Text != openaitest.CompletionText {
+			t.Fatalf("Expected completion, got %#v, %#v", res, err)
+		}
+		if md.CacheHit != (i == 1) {
+			t.Errorf("Expected cache hit %v, got %v", i == 1, md.CacheHit)
+		}
+		if _, err := client.CreateCompletion(context.Background(), openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "Say this is a test", Temperature: &one}); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+		if _, err := client.Moderation(context.Background(), openai.ModerationRequest{Input: []string{"a"}}); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+	}
+	server.Fake.AssertCalled(t, openai.OperationCreateCompletion, 3)
+	server.Fake.AssertCalled(t, openai.OperationModeration, 1)
+	if n := accountant.Snapshot().Total.Requests; n != 4 {
+		t.Errorf("Expected 4 recorded requests without cache hits, got %d", n)
+	}
+}
+
+func TestCacheAccounts(t *testing.T) {
+	t.Parallel()
+	server := openaitest.NewServer(nil)
+	defer server.Close()
+	store := openai.NewMemoryCache(10)
+	client := server.OpenAI(openai.WithCache(store, time.Hour))
+	other := openai.NewOpenAI("other-key", openai.WithBaseURL(server.URL), openai.WithCache(store, time.Hour))
+	req := openai.ModerationRequest{Input: []string{"a"}}
+	ctx := context.Background()
+
+	calls := []struct {
+		client openai.OpenAI
+		ctx    context.Context
+		hit    bool
+	}{
+		{client, ctx, false},
+		{client, ctx, true},
+		{client, openai.WithRequestOrganization(ctx, "org-b"), false},
+		{client, openai.WithRequestOrganization(ctx, "org-b"), true},
+		{client, openai.WithRequestHeaders(ctx, http.Header{"X-Tenant": {"b"}}), false},
+		{other, ctx, false},
+	}
+	for i, c := range calls {
+		ctx, md := openai.WithResponseMetadata(c.ctx)
+		if _, err := c.client.Moderation(ctx, req); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+		if md.CacheHit != c.hit {
+			t.Errorf("Expected cache hit %v for call %d, got %v", c.hit, i, md.CacheHit)
+		}
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	cache := openai.NewMemoryCache(2)
+	cache.Set(ctx, "a", []byte("1"), 0)
+	cache.Set(ctx, "b", []byte("2"), 0)
+	cache.Get(ctx, "a")
+	cache.Set(ctx, "c", []byte("3"), 0)
+	if _, ok, _ := cache.Get(ctx, "b"); ok {
+		t.Error("Expected least recently used value to be evicted")
+	}
+	if v, ok, _ := cache.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Errorf("Expected 1, got %q, %v", v, ok)
+	}
+	cache.Set(ctx, "d", []byte("4"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok, _ := cache.Get(ctx, "d"); ok {
+		t.Error("Expected expired value to be missing")
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+	cache, err := openai.NewDiskCache(dir)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if err := cache.Set(ctx, "a/b", []byte("1"), 0); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	reopened, _ := openai.NewDiskCache(dir)
+	if v, ok, err := reopened.Get(ctx, "a/b"); err != nil || !ok || string(v) != "1" {
+		t.Errorf("Expected 1, got %q, %v, %#v", v, ok, err)
+	}
+	if _, ok, _ := reopened.Get(ctx, "missing"); ok {
+		t.Error("Expected missing value")
+	}
+	cache.Set(ctx, "c", []byte("2"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok, _ := cache.Get(ctx, "c"); ok {
+		t.Error("Expected expired value to be missing")
+	}
+}
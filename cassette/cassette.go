@@ -0,0 +1,322 @@
+// Package cassette records HTTP interactions with the OpenAI API to files and
+// replays them, so tests of code using the OpenAI API client run offline and
+// deterministically.
+//
+// Record a cassette once against the real API:
+//
+//	recorder := cassette.NewRecorder("testdata/edit.json", http.DefaultClient)
+//	client := openai.NewOpenAI(apiKey, openai.WithHttpClient(recorder))
+//
+// and replay it in tests:
+//
+//	replayer, err := cassette.NewReplayer("testdata/edit.json")
+//	client := openai.NewOpenAI("sk-test", openai.WithHttpClient(replayer))
+//
+// Secrets in request and response headers, like the API key, organization,
+// cookies and request IDs, are redacted before a cassette is written.
+// Requests are matched by method, path, query and normalized body, so the
+// random multipart boundaries and the order of JSON object keys do not
+// matter.
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/noclue/openai"
+)
+
+// redacted replaces secrets in recorded headers.
+const redacted = "[REDACTED]"
+
+// redactedHeaders are the request and response headers whose values are
+// never recorded.
+var redactedHeaders = []string{"Authorization", "Api-Key", "OpenAI-Organization", "OpenAI-Project"}
+
+// redactedResponseHeaders are the additional response headers whose values
+// are never recorded.
+var redactedResponseHeaders = []string{"Set-Cookie", "X-Request-Id"}
+
+// volatileHeaders are the request headers that differ between runs and are
+// not recorded.
+var volatileHeaders = []string{"X-Request-Id", "Idempotency-Key", "Traceparent", "Tracestate"}
+
+// ErrNoInteraction is the error returned by a Replayer when a request does not
+// match any recorded interaction.
+var ErrNoInteraction = errors.New("cassette: no recorded interaction matches the request")
+
+// Request is a recorded HTTP request.
+type Request struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	// Body is the normalized request body. JSON bodies are compacted with
+	// object keys sorted. Multipart form bodies are recorded as a JSON object
+	// of the form fields with files replaced by their SHA-256 digests.
+	Body string `json:"body,omitempty"`
+}
+
+// Response is a recorded HTTP response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Load reads the cassette file at path.
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cassette: read error: %w", err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("cassette: decoding error: %w", err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to the file at path.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cassette: encoding error: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("cassette: write error: %w", err)
+	}
+	return nil
+}
+
+// Recorder is an HTTP client that sends requests with another client and
+// records the interactions to a cassette file. It is safe for concurrent use.
+type Recorder struct {
+	mu       sync.Mutex
+	path     string
+	next     openai.HttpClient
+	cassette Cassette
+}
+
+// NewRecorder creates a recorder that sends requests with next and writes the
+// interactions to the file at path, replacing its content. The file is
+// written after every interaction.
+func NewRecorder(path string, next openai.HttpClient) *Recorder {
+	return &Recorder{path: path, next: next}
+}
+
+// Do sends the request and records the interaction.
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+	recorded, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cassette: response read error: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: recorded,
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     redactHeader(resp.Header.Clone(), redactedHeaders, redactedResponseHeaders),
+			Body:       string(body),
+		},
+	})
+	if err := r.cassette.Save(r.path); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Replayer is an HTTP client that answers requests with the responses of the
+// matching interactions of a cassette. It is safe for concurrent use.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewReplayer creates a replayer of the cassette file at path.
+func NewReplayer(path string) (*Replayer, error) {
+	c, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Replayer{
+		interactions: c.Interactions,
+		used:         make([]bool, len(c.Interactions)),
+	}, nil
+}
+
+// Do returns the response of the first unused interaction matching the
+// request. Once all matching interactions are used, the last one is replayed
+// again. It returns ErrNoInteraction if no interaction matches.
+func (r *Replayer) Do(req *http.Request) (*http.Response, error) {
+	recorded, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	match := -1
+	for i, interaction := range r.interactions {
+		if !matches(interaction.Request, recorded) {
+			continue
+		}
+		match = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("%w: %v %v", ErrNoInteraction, req.Method, req.URL.Path)
+	}
+	r.used[match] = true
+	resp := r.interactions[match].Response
+	return &http.Response{
+		StatusCode: resp.StatusCode,
+		Status:     fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+		Header:     resp.Header.Clone(),
+		Body:       io.NopCloser(bytes.NewReader([]byte(resp.Body))),
+		Request:    req,
+	}, nil
+}
+
+func matches(recorded, req Request) bool {
+	return recorded.Method == req.Method &&
+		recorded.Path == req.Path &&
+		recorded.Query == req.Query &&
+		recorded.Body == req.Body
+}
+
+// recordRequest returns the redacted and normalized form of the request. The
+// request body is restored so the request can still be sent.
+func recordRequest(req *http.Request) (Request, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return Request{}, fmt.Errorf("cassette: request read error: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	normalized, err := normalizeBody(req.Header.Get("Content-Type"), body)
+	if err != nil {
+		return Request{}, err
+	}
+	header := req.Header.Clone()
+	for _, name := range volatileHeaders {
+		header.Del(name)
+	}
+	redactHeader(header, redactedHeaders)
+	return Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query().Encode(),
+		Header: header,
+		Body:   normalized,
+	}, nil
+}
+
+// redactHeader replaces the values of the named headers present in header
+// and returns it.
+func redactHeader(header http.Header, names ...[]string) http.Header {
+	for _, list := range names {
+		for _, name := range list {
+			if header.Get(name) != "" {
+				header.Set(name, redacted)
+			}
+		}
+	}
+	return header
+}
+
+// normalizeBody returns a representation of the body that is the same for
+// requests that are equivalent.
+func normalizeBody(contentType string, body []byte) (string, error) {
+	if len(body) == 0 {
+		return "", nil
+	}
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/json":
+		var doc any
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return string(body), nil
+		}
+		normalized, err := json.Marshal(doc)
+		if err != nil {
+			return "", fmt.Errorf("cassette: request body encoding error: %w", err)
+		}
+		return string(normalized), nil
+	case "multipart/form-data":
+		return normalizeMultipart(body, params["boundary"])
+	default:
+		return string(body), nil
+	}
+}
+
+// normalizeMultipart returns the fields of a multipart form as a JSON object.
+// Files are represented by their name and SHA-256 digest.
+func normalizeMultipart(body []byte, boundary string) (string, error) {
+	fields := map[string]string{}
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("cassette: multipart request body read error: %w", err)
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return "", fmt.Errorf("cassette: multipart request body read error: %w", err)
+		}
+		if part.FileName() != "" {
+			sum := sha256.Sum256(content)
+			fields[part.FormName()] = part.FileName() + " sha256:" + hex.EncodeToString(sum[:])
+		} else {
+			fields[part.FormName()] = string(content)
+		}
+	}
+	// json.Marshal sorts the keys of maps.
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("cassette: request body encoding error: %w", err)
+	}
+	return string(normalized), nil
+}
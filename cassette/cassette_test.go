@@ -0,0 +1,120 @@
+package cassette_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/cassette"
+)
+
+const apiKey = "sk-12345"
+
+type mockHttpClient struct {
+	requests int
+}
+
+func (m *mockHttpClient) Do(req *http.Request) (*http.Response, error) {
+	m.requests++
+	body := `{"created": 1632632576, "data": [{"url": "https://example.com/` + req.URL.Path + `"}]}`
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header: http.Header{
+			"Content-Type":        {"application/json"},
+			"Openai-Organization": {"org-secret"},
+			"Set-Cookie":          {"session=cookie-secret"},
+			"X-Request-Id":        {"req-secret"},
+		},
+	}, nil
+}
+
+// TestReplay replays a committed cassette.
+func TestReplay(t *testing.T) {
+	t.Parallel()
+	replayer, err := cassette.NewReplayer("testdata/edit.json")
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	c := openai.NewOpenAI("sk-test", openai.WithHttpClient(replayer))
+	res, err := c.Edit(context.Background(), openai.EditRequest{
+		Model:       "text-davinci-edit-001",
+		Input:       "What day of thet wek is it?",
+		Instruction: "Fix the spelling mistakes",
+	})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if res.Choices[0].Text != "What day of the week is it?\n" {
+		t.Errorf("Expected corrected text, got %q", res.Choices[0].Text)
+	}
+
+	_, err = c.Edit(context.Background(), openai.EditRequest{Model: "text-davinci-edit-001", Input: "other"})
+	if !errors.Is(err, cassette.ErrNoInteraction) {
+		t.Errorf("Expected ErrNoInteraction, got %#v", err)
+	}
+}
+
+// TestRecordAndReplay records JSON and multipart requests and replays them
+// without the recorded client.
+func TestRecordAndReplay(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "images.json")
+	mock := &mockHttpClient{}
+	recording := openai.NewOpenAI(apiKey,
+		openai.WithHttpClient(cassette.NewRecorder(path, mock)),
+		openai.WithOrganization("org-secret"))
+	n := 2
+	create := openai.CreateImageReq{Prompt: "This is a test", CommonImageReq: openai.CommonImageReq{N: &n}}
+	variations := openai.CreateImageVariationsReq{Image: "../testdata/image.png", CommonImageReq: openai.CommonImageReq{Size: openai.SmallImage}}
+	if _, err := recording.CreateImage(context.Background(), create); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if _, err := recording.CreateImageVariations(context.Background(), variations); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	for _, secret := range []string{apiKey, "org-secret", "cookie-secret", "req-secret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Expected %q to be redacted", secret)
+		}
+	}
+
+	replayer, err := cassette.NewReplayer(path)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	replaying := openai.NewOpenAI("sk-other", openai.WithHttpClient(replayer))
+	res, err := replaying.CreateImageVariations(context.Background(), variations)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if res.Data[0].URL != "https://example.com//v1/images/variations" {
+		t.Errorf("Expected variations response, got %s", res.Data[0].URL)
+	}
+	res, err = replaying.CreateImage(context.Background(), create)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if res.Data[0].URL != "https://example.com//v1/images/generations" {
+		t.Errorf("Expected generations response, got %s", res.Data[0].URL)
+	}
+	if mock.requests != 2 {
+		t.Errorf("Expected 2 recorded requests, got %d", mock.requests)
+	}
+
+	n = 3
+	if _, err := replaying.CreateImage(context.Background(), create); !errors.Is(err, cassette.ErrNoInteraction) {
+		t.Errorf("Expected ErrNoInteraction for a different body, got %#v", err)
+	}
+}
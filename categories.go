@@ -0,0 +1,311 @@
+package openai
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// ModerationCategories tells which categories a text is flagged for.
+type ModerationCategories struct {
+	Hate                  bool
+	HateThreatening       bool
+	Harassment            bool
+	HarassmentThreatening bool
+	SelfHarm              bool
+	SelfHarmIntent        bool
+	SelfHarmInstructions  bool
+	Sexual                bool
+	SexualMinors          bool
+	Violence              bool
+	ViolenceGraphic       bool
+	Illicit               bool
+	IllicitViolent        bool
+	// Other holds the categories unknown to this package by their name.
+	Other map[string]bool
+
+	// present is the set of known categories that were set, by categoryBit.
+	present uint32
+}
+
+// categoryBit returns the bit of the known category in the presence sets of
+// categories and scores, or zero if the category is unknown.
+func categoryBit(category string) uint32 {
+	for i, c := range categoryOrder {
+		if c == category {
+			return 1 << i
+		}
+	}
+	return 0
+}
+
+// field returns the field of the known category, or nil.
+func (c *ModerationCategories) field(category string) *bool {
+	switch category {
+	case CategoryHate:
+		return &c.Hate
+	case CategoryHateThreatening:
+		return &c.HateThreatening
+	case CategoryHarassment:
+		return &c.Harassment
+	case CategoryHarassmentThreatening:
+		return &c.HarassmentThreatening
+	case CategorySelfHarm:
+		return &c.SelfHarm
+	case CategorySelfHarmIntent:
+		return &c.SelfHarmIntent
+	case CategorySelfHarmInstructions:
+		return &c.SelfHarmInstructions
+	case CategorySexual:
+		return &c.Sexual
+	case CategorySexualMinors:
+		return &c.SexualMinors
+	case CategoryViolence:
+		return &c.Violence
+	case CategoryViolenceGraphic:
+		return &c.ViolenceGraphic
+	case CategoryIllicit:
+		return &c.Illicit
+	case CategoryIllicitViolent:
+		return &c.IllicitViolent
+	default:
+		return nil
+	}
+}
+
+// Get returns whether the text is flagged for the category, known or not.
+func (c ModerationCategories) Get(category string) bool {
+	if f := c.field(category); f != nil {
+		return *f
+	}
+	return c.Other[category]
+}
+
+// Set sets whether the text is flagged for the category, known or not.
+func (c *ModerationCategories) Set(category string, flagged bool) {
+	if f := c.field(category); f != nil {
+		*f = flagged
+		c.present |= categoryBit(category)
+		return
+	}
+	if c.Other == nil {
+		c.Other = make(map[string]bool)
+	}
+	c.Other[category] = flagged
+}
+
+// has reports whether the category was set or decoded, or is flagged.
+func (c ModerationCategories) has(category string) bool {
+	if f := c.field(category); f != nil {
+		return *f || c.present&categoryBit(category) != 0
+	}
+	_, ok := c.Other[category]
+	return ok
+}
+
+// Map returns the categories by name, including the unknown categories. Known
+// categories that were neither set nor decoded and are not flagged are left
+// out, so that decoding and encoding a response keeps its categories.
+func (c ModerationCategories) Map() map[string]bool {
+	m := make(map[string]bool, len(categoryOrder)+len(c.Other))
+	for category, flagged := range c.Other {
+		m[category] = flagged
+	}
+	for _, category := range categoryOrder {
+		if c.has(category) {
+			m[category] = c.Get(category)
+		}
+	}
+	return m
+}
+
+// MarshalJSON encodes the categories as an object keyed by category name.
+func (c ModerationCategories) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Map())
+}
+
+// UnmarshalJSON decodes the categories from an object keyed by category name.
+func (c *ModerationCategories) UnmarshalJSON(data []byte) error {
+	var m map[string]bool
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*c = ModerationCategories{}
+	for category, flagged := range m {
+		c.Set(category, flagged)
+	}
+	return nil
+}
+
+// MarshalYAML encodes the categories as a mapping keyed by category name.
+func (c ModerationCategories) MarshalYAML() (any, error) {
+	return c.Map(), nil
+}
+
+// ModerationCategoryScores are the scores of a text per category.
+type ModerationCategoryScores struct {
+	Hate                  float64
+	HateThreatening       float64
+	Harassment            float64
+	HarassmentThreatening float64
+	SelfHarm              float64
+	SelfHarmIntent        float64
+	SelfHarmInstructions  float64
+	Sexual                float64
+	SexualMinors          float64
+	Violence              float64
+	ViolenceGraphic       float64
+	Illicit               float64
+	IllicitViolent        float64
+	// Other holds the scores of the categories unknown to this package by
+	// their name.
+	Other map[string]float64
+
+	// present is the set of known categories that were set, by categoryBit.
+	present uint32
+}
+
+// field returns the field of the known category, or nil.
+func (s *ModerationCategoryScores) field(category string) *float64 {
+	switch category {
+	case CategoryHate:
+		return &s.Hate
+	case CategoryHateThreatening:
+		return &s.HateThreatening
+	case CategoryHarassment:
+		return &s.Harassment
+	case CategoryHarassmentThreatening:
+		return &s.HarassmentThreatening
+	case CategorySelfHarm:
+		return &s.SelfHarm
+	case CategorySelfHarmIntent:
+		return &s.SelfHarmIntent
+	case CategorySelfHarmInstructions:
+		return &s.SelfHarmInstructions
+	case CategorySexual:
+		return &s.Sexual
+	case CategorySexualMinors:
+		return &s.SexualMinors
+	case CategoryViolence:
+		return &s.Violence
+	case CategoryViolenceGraphic:
+		return &s.ViolenceGraphic
+	case CategoryIllicit:
+		return &s.Illicit
+	case CategoryIllicitViolent:
+		return &s.IllicitViolent
+	default:
+		return nil
+	}
+}
+
+// Get returns the score of the category, known or not.
+func (s ModerationCategoryScores) Get(category string) float64 {
+	if f := s.field(category); f != nil {
+		return *f
+	}
+	return s.Other[category]
+}
+
+// Set sets the score of the category, known or not.
+func (s *ModerationCategoryScores) Set(category string, score float64) {
+	if f := s.field(category); f != nil {
+		*f = score
+		s.present |= categoryBit(category)
+		return
+	}
+	if s.Other == nil {
+		s.Other = make(map[string]float64)
+	}
+	s.Other[category] = score
+}
+
+// has reports whether the score of the category was set or decoded, or is
+// not zero.
+func (s ModerationCategoryScores) has(category string) bool {
+	if f := s.field(category); f != nil {
+		return *f != 0 || s.present&categoryBit(category) != 0
+	}
+	_, ok := s.Other[category]
+	return ok
+}
+
+// Map returns the scores by category name, including the unknown categories.
+// Known categories whose score was neither set nor decoded and is zero are
+// left out, so that decoding and encoding a response keeps its categories.
+func (s ModerationCategoryScores) Map() map[string]float64 {
+	m := make(map[string]float64, len(categoryOrder)+len(s.Other))
+	for category, score := range s.Other {
+		m[category] = score
+	}
+	for _, category := range categoryOrder {
+		if s.has(category) {
+			m[category] = s.Get(category)
+		}
+	}
+	return m
+}
+
+// MarshalJSON encodes the scores as an object keyed by category name.
+func (s ModerationCategoryScores) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Map())
+}
+
+// UnmarshalJSON decodes the scores from an object keyed by category name.
+func (s *ModerationCategoryScores) UnmarshalJSON(data []byte) error {
+	var m map[string]float64
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*s = ModerationCategoryScores{}
+	for category, score := range m {
+		s.Set(category, score)
+	}
+	return nil
+}
+
+// MarshalYAML encodes the scores as a mapping keyed by category name.
+func (s ModerationCategoryScores) MarshalYAML() (any, error) {
+	return s.Map(), nil
+}
+
+// names returns the known categories followed by the sorted unknown
+// categories of the result.
+func (r ModerationResult) names() []string {
+	other := make([]string, 0, len(r.Categories.Other)+len(r.CategoryScores.Other))
+	seen := make(map[string]bool)
+	for category := range r.Categories.Other {
+		other, seen[category] = append(other, category), true
+	}
+	for category := range r.CategoryScores.Other {
+		if !seen[category] {
+			other = append(other, category)
+		}
+	}
+	sort.Strings(other)
+	return append(append([]string(nil), categoryOrder[:]...), other...)
+}
+
+// MaxCategory returns the category with the highest score and its score. It
+// returns an empty category if no score is above zero.
+func (r ModerationResult) MaxCategory() (string, float64) {
+	var max string
+	var maxScore float64
+	for _, category := range r.names() {
+		if score := r.CategoryScores.Get(category); score > maxScore {
+			max, maxScore = category, score
+		}
+	}
+	return max, maxScore
+}
+
+// FlaggedCategories returns the categories the text is flagged for, known
+// categories first in the order of Categories().
+func (r ModerationResult) FlaggedCategories() []string {
+	var flagged []string
+	for _, category := range r.names() {
+		if r.Categories.Get(category) {
+			flagged = append(flagged, category)
+		}
+	}
+	return flagged
+}
@@ -0,0 +1,100 @@
+package openai_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/noclue/openai"
+)
+
+const moderationResult = `{
+	"flagged": true,
+	"categories": {
+		"hate": false,
+		"harassment": true,
+		"self-harm/intent": true,
+		"violence": false,
+		"future/category": true
+	},
+	"category_scores": {
+		"hate": 0.1,
+		"harassment": 0.7,
+		"self-harm/intent": 0.9,
+		"violence": 0.2,
+		"future/category": 0.95
+	}
+}`
+
+func TestModerationCategories(t *testing.T) {
+	t.Parallel()
+	var result openai.ModerationResult
+	if err := json.Unmarshal([]byte(moderationResult), &result); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if !result.Categories.Harassment || !result.Categories.SelfHarmIntent || result.Categories.Hate {
+		t.Errorf("Expected typed categories, got %#v", result.Categories)
+	}
+	if result.CategoryScores.SelfHarmIntent != 0.9 || result.CategoryScores.Get(openai.CategoryHarassment) != 0.7 {
+		t.Errorf("Expected typed scores, got %#v", result.CategoryScores)
+	}
+	if !result.Categories.Other["future/category"] || result.CategoryScores.Other["future/category"] != 0.95 {
+		t.Errorf("Expected unknown category in overflow maps, got %#v, %#v", result.Categories.Other, result.CategoryScores.Other)
+	}
+
+	if category, score := result.MaxCategory(); category != "future/category" || score != 0.95 {
+		t.Errorf("Expected future/category 0.95, got %v %v", category, score)
+	}
+	want := []string{openai.CategoryHarassment, openai.CategorySelfHarmIntent, "future/category"}
+	if flagged := result.FlaggedCategories(); !reflect.DeepEqual(flagged, want) {
+		t.Errorf("Expected %v, got %v", want, flagged)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	var roundTrip openai.ModerationResult
+	if err := json.Unmarshal(data, &roundTrip); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if !reflect.DeepEqual(roundTrip, result) {
+		t.Errorf("Expected %#v, got %#v", result, roundTrip)
+	}
+	var raw struct {
+		Categories map[string]bool `json:"categories"`
+	}
+	json.Unmarshal(data, &raw)
+	if len(raw.Categories) != 5 || !raw.Categories["harassment"] {
+		t.Errorf("Expected the decoded categories only, got %v", raw.Categories)
+	}
+
+	var set openai.ModerationResult
+	set.Categories.Violence = true
+	set.CategoryScores.Set(openai.CategoryHate, 0)
+	data, err = json.Marshal(set)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if want := `{"categories":{"violence":true},"category_scores":{"hate":0},"flagged":false}`; string(data) != want {
+		t.Errorf("Expected %v, got %s", want, data)
+	}
+
+	if category, score := (openai.ModerationResult{}).MaxCategory(); category != "" || score != 0 {
+		t.Errorf("Expected no category, got %v %v", category, score)
+	}
+}
+
+func TestCategoriesCopy(t *testing.T) {
+	t.Parallel()
+	categories := openai.Categories()
+	categories[0], categories[1] = categories[1], categories[0]
+	var c openai.ModerationCategories
+	c.Set(openai.CategoryHate, false)
+	if m := c.Map(); len(m) != 1 || m[openai.CategoryHate] {
+		t.Errorf("Expected only hate present and not flagged, got %v", m)
+	}
+	if got := openai.Categories(); got[0] != openai.CategoryHate {
+		t.Errorf("Expected changes to the returned categories to be ignored, got %v", got)
+	}
+}
@@ -0,0 +1,183 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultChunkTokens is the default maximum number of tokens of a chunk
+	// of moderated text.
+	DefaultChunkTokens = 1000
+	// DefaultChunkBatchSize is the default maximum number of chunks sent in
+	// one moderation request.
+	DefaultChunkBatchSize = 32
+)
+
+// chunkSeparators are where chunks preferably end, in order of preference.
+var chunkSeparators = []string{"\n\n", "\n", " "}
+
+// ChunkOptions configures how ModerateChunked splits and batches inputs.
+type ChunkOptions struct {
+	// MaxTokens is the maximum estimated number of tokens of a chunk. The
+	// default is DefaultChunkTokens.
+	MaxTokens int
+	// Overlap is the maximum estimated number of tokens at the end of a chunk
+	// that are repeated at the start of the next chunk, so that text across a
+	// chunk boundary is moderated in context. The default is a tenth of
+	// MaxTokens, and it is at most half of MaxTokens. A negative Overlap
+	// disables overlapping.
+	Overlap int
+	// BatchSize is the maximum number of chunks sent in one request. The
+	// default is DefaultChunkBatchSize.
+	BatchSize int
+}
+
+// ModerationChunk is the moderation result of a chunk of an input.
+type ModerationChunk struct {
+	// Start is the byte offset of the chunk in the input.
+	Start int `json:"start" yaml:"start"`
+	// End is the byte offset of the end of the chunk in the input.
+	End int `json:"end" yaml:"end"`
+	// Result is the moderation result of the chunk.
+	Result ModerationResult `json:"result" yaml:"result"`
+}
+
+// ChunkedModerationResult is the moderation result of an input merged from
+// the results of its chunks.
+type ChunkedModerationResult struct {
+	// Result holds the highest score of every category among the chunks, and
+	// is flagged for the categories and if any chunk is.
+	Result ModerationResult `json:"result" yaml:"result"`
+	// Chunks are the results of the chunks in the order of the input.
+	Chunks []ModerationChunk `json:"chunks" yaml:"chunks"`
+}
+
+// FlaggedChunks returns the chunks that are flagged.
+func (r ChunkedModerationResult) FlaggedChunks() []ModerationChunk {
+	var res []ModerationChunk
+	for _, chunk := range r.Chunks {
+		if chunk.Result.Flagged {
+			res = append(res, chunk)
+		}
+	}
+	return res
+}
+
+// ChunkedModerationResponse is the response of ModerateChunked.
+type ChunkedModerationResponse struct {
+	// Model is the model used for moderation.
+	Model string `json:"model" yaml:"model"`
+	// Results are the merged results in the order of the inputs.
+	Results []ChunkedModerationResult `json:"results" yaml:"results"`
+}
+
+// ModerateChunked moderates inputs of any length and number with client. It
+// splits every input into overlapping chunks of at most options.MaxTokens
+// estimated tokens, preferably at paragraph, line or word boundaries, sends
+// the chunks in requests of at most options.BatchSize inputs, and merges the
+// results of the chunks of every input.
+func ModerateChunked(ctx context.Context, client OpenAI, req ModerationRequest, options ChunkOptions) (*ChunkedModerationResponse, error) {
+	if options.MaxTokens <= 0 {
+		options.MaxTokens = DefaultChunkTokens
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultChunkBatchSize
+	}
+	switch {
+	case options.Overlap < 0:
+		options.Overlap = 0
+	case options.Overlap == 0:
+		options.Overlap = options.MaxTokens / 10
+	}
+	options.Overlap = min(options.Overlap, options.MaxTokens/2)
+	type span struct{ input, start, end int }
+	var spans []span
+	for i, input := range req.Input {
+		for _, s := range splitText(input, options.MaxTokens, options.Overlap) {
+			spans = append(spans, span{i, s[0], s[1]})
+		}
+	}
+
+	key := requestOptionsFromContext(ctx).idempotencyKey
+	resp := &ChunkedModerationResponse{Results: make([]ChunkedModerationResult, len(req.Input))}
+	for batchNum := 0; len(spans) > 0; batchNum++ {
+		batch := spans[:min(len(spans), options.BatchSize)]
+		spans = spans[len(batch):]
+		batchReq := ModerationRequest{Model: req.Model, Input: make([]string, len(batch))}
+		for i, s := range batch {
+			batchReq.Input[i] = req.Input[s.input][s.start:s.end]
+		}
+		batchCtx := ctx
+		if key != "" {
+			batchCtx = WithIdempotencyKey(ctx, derivedIdempotencyKey(key, "batch-"+strconv.Itoa(batchNum)))
+		}
+		batchResp, err := client.Moderation(batchCtx, batchReq)
+		if err != nil {
+			return nil, err
+		}
+		if len(batchResp.Results) != len(batch) {
+			return nil, fmt.Errorf("openai: got %d moderation results for %d inputs", len(batchResp.Results), len(batch))
+		}
+		resp.Model = batchResp.Model
+		for i, s := range batch {
+			res := &resp.Results[s.input]
+			res.Chunks = append(res.Chunks, ModerationChunk{Start: s.start, End: s.end, Result: batchResp.Results[i]})
+			res.Result.merge(batchResp.Results[i])
+		}
+	}
+	return resp, nil
+}
+
+// merge merges other into the result, keeping the highest scores and every
+// flag.
+func (r *ModerationResult) merge(other ModerationResult) {
+	r.Flagged = r.Flagged || other.Flagged
+	for _, category := range other.names() {
+		if other.Categories.has(category) {
+			r.Categories.Set(category, r.Categories.Get(category) || other.Categories.Get(category))
+		}
+		if other.CategoryScores.has(category) {
+			r.CategoryScores.Set(category, max(r.CategoryScores.Get(category), other.CategoryScores.Get(category)))
+		}
+	}
+}
+
+// splitText splits s into spans of at most maxTokens estimated tokens and
+// returns their start and end offsets. Spans end after the last paragraph,
+// line or word separator in their second half if any, and never inside a UTF-8
+// encoded rune. Every span but the first starts with up to overlap estimated
+// tokens of the end of the previous span, from a line or word boundary if
+// there is one. An empty s is a single empty span.
+func splitText(s string, maxTokens, overlap int) [][2]int {
+	var spans [][2]int
+	start := 0
+	for {
+		end := start + tokenPrefix(s[start:], maxTokens)
+		if end == len(s) {
+			return append(spans, [2]int{start, end})
+		}
+		if end == start {
+			_, size := utf8.DecodeRuneInString(s[start:])
+			end = start + size
+		}
+		for _, sep := range chunkSeparators {
+			if i := strings.LastIndex(s[start:end], sep); i > (end-start)/2 {
+				end = start + i + len(sep)
+				break
+			}
+		}
+		spans = append(spans, [2]int{start, end})
+		next := end - tokenSuffix(s[start:end], overlap)
+		if i := strings.IndexAny(s[next:end], "\n "); i >= 0 && next > 0 && !strings.ContainsRune("\n ", rune(s[next-1])) {
+			next += i + 1
+		}
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+}
@@ -0,0 +1,101 @@
+package openai_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaitest"
+)
+
+func TestModerateChunked(t *testing.T) {
+	t.Parallel()
+	fake := openaitest.NewFake().Handle(openai.OperationModeration, func(ctx context.Context, request any) (any, error) {
+		req := request.(openai.ModerationRequest)
+		resp := &openai.ModerationResponse{Model: "text-moderation-latest"}
+		for _, input := range req.Input {
+			var result openai.ModerationResult
+			if strings.Contains(input, "bad") {
+				result.Flagged = true
+				result.Categories.Violence = true
+				result.CategoryScores.Violence = 0.9
+			} else {
+				result.CategoryScores.Hate = 0.1
+			}
+			resp.Results = append(resp.Results, result)
+		}
+		return resp, nil
+	})
+	// 12 bytes per line: 2 lines fit in a chunk of 6 tokens.
+	long := "good line 1\ngood line 2\nbad line 3\ngood line 4\n"
+	resp, err := openai.ModerateChunked(context.Background(), fake, openai.ModerationRequest{
+		Input: []string{long, "short", ""},
+	}, openai.ChunkOptions{MaxTokens: 6, BatchSize: 2})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	fake.AssertCalled(t, openai.OperationModeration, 2)
+	if len(resp.Results) != 3 || resp.Model != "text-moderation-latest" {
+		t.Fatalf("Expected 3 results, got %#v", resp)
+	}
+
+	res := resp.Results[0]
+	if len(res.Chunks) != 2 || res.Chunks[0].End != 24 || res.Chunks[1].Start != 24 || res.Chunks[1].End != len(long) {
+		t.Fatalf("Expected chunks split at line 3, got %#v", res.Chunks)
+	}
+	flagged := res.FlaggedChunks()
+	if len(flagged) != 1 || long[flagged[0].Start:flagged[0].End] != "bad line 3\ngood line 4\n" {
+		t.Errorf("Expected the chunk of line 3 to be flagged, got %#v", flagged)
+	}
+	if !res.Result.Flagged || !res.Result.Categories.Violence ||
+		res.Result.CategoryScores.Violence != 0.9 || res.Result.CategoryScores.Hate != 0.1 {
+		t.Errorf("Expected merged result, got %#v", res.Result)
+	}
+	for _, res := range resp.Results[1:] {
+		if len(res.Chunks) != 1 || res.Result.Flagged {
+			t.Errorf("Expected a single unflagged chunk, got %#v", res)
+		}
+	}
+}
+
+func TestModerateChunkedRunes(t *testing.T) {
+	t.Parallel()
+	fake := openaitest.NewFake()
+	// Every non-ASCII character is estimated as a token of its own.
+	input := strings.Repeat("猫", 10)
+	resp, err := openai.ModerateChunked(context.Background(), fake, openai.ModerationRequest{Input: []string{input}},
+		openai.ChunkOptions{MaxTokens: 2})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	chunks := resp.Results[0].Chunks
+	if len(chunks) != 5 {
+		t.Fatalf("Expected 5 chunks, got %#v", chunks)
+	}
+	for _, chunk := range chunks {
+		if s := input[chunk.Start:chunk.End]; s != "猫猫" {
+			t.Errorf("Expected two whole runes, got %q", s)
+		}
+	}
+}
+
+func TestModerateChunkedOverlap(t *testing.T) {
+	t.Parallel()
+	fake := openaitest.NewFake()
+	input := "good line 1\ngood line 2\nbad line 3\ngood line 4\n"
+	resp, err := openai.ModerateChunked(context.Background(), fake, openai.ModerationRequest{Input: []string{input}},
+		openai.ChunkOptions{MaxTokens: 6, Overlap: 3})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	var got []string
+	for _, chunk := range resp.Results[0].Chunks {
+		got = append(got, input[chunk.Start:chunk.End])
+	}
+	want := []string{"good line 1\ngood line 2\n", "good line 2\nbad line 3\n", "bad line 3\ngood line 4\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected chunks overlapping by a line, got %q", got)
+	}
+}
@@ -0,0 +1,45 @@
+package openaictl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/noclue/openai"
+	"github.com/spf13/cobra"
+)
+
+// budgetsCmd creates the budgets command.
+func budgetsCmd() *cobra.Command {
+	var budgetsCmd = &cobra.Command{
+		Use:   "budgets",
+		Short: "Show spending budgets and the spend in the current period",
+		Long:  `Show the spending budgets stored in the file set with --budget-file and the spend recorded against them in the current period as yaml. Commands run with --budget-file refuse requests that would exceed a budget.`,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			budgets()
+		},
+	}
+	return budgetsCmd
+}
+
+func budgets() {
+	if budgetFile == "" {
+		fmt.Println("Budget file is required")
+		os.Exit(1)
+	}
+	tracker := loadBudgets()
+	printResponse(map[string]any{
+		"budgets": tracker.Budgets(),
+		"spend":   tracker.Status(),
+	})
+}
+
+// loadBudgets loads the budget tracker from the budget file.
+func loadBudgets() *openai.BudgetTracker {
+	tracker, err := openai.NewBudgetTracker(budgetFile, openai.DefaultPricing)
+	if err != nil {
+		fmt.Printf("Error loading budget file: %+v", err)
+		os.Exit(1)
+	}
+	return tracker
+}
@@ -3,11 +3,17 @@ package openaictl
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/noclue/openai"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 )
 
+// apiKeyCommandTTL is the time the API key printed by --api-key-command is
+// used for before the command is run again.
+const apiKeyCommandTTL = 5 * time.Minute
+
 // Flags
 var n int
 var size string
@@ -22,14 +28,39 @@ var outputFile string
 var model string
 var instructionFile string
 var instruction string
+var budgetFile string
+var metricsAddr string
+var addr string
+var responsesFile string
+var errorRate float64
+var errorStatus int
+var latency time.Duration
+var latencyJitter time.Duration
+var seed int64
+var clientsFile string
+var rateLimit float64
+var burst int
+var cacheSize int
+var cacheTTL time.Duration
+var cacheDir string
+var apiKeyFile string
+var apiKeyCommand string
+var auditLog string
+var policyFile string
+var chunkTokens int
+var segmentMode string
+var reportFormat string
 
 func Run() {
 	var rootCmd = &cobra.Command{
 		Use:   "openai",
 		Short: "OpenAI CLI",
-		Long:  `OpenAI CLI is a command line tool for interacting with the OpenAI API. To authorize access set the OPENAI_API_KEY environment variable to your OpenAI API key.`,
+		Long:  `OpenAI CLI is a command line tool for interacting with the OpenAI API. To authorize access set the OPENAI_API_KEY environment variable to your OpenAI API key, or read the key from a file or the output of a command with --api-key-file or --api-key-command.`,
 	}
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.PersistentFlags().StringVar(&apiKeyFile, "api-key-file", "", "file to read the API key from whenever it changes (optional, default: OPENAI_API_KEY)")
+	rootCmd.PersistentFlags().StringVar(&apiKeyCommand, "api-key-command", "", "shell command printing the API key, e.g. of a password manager (optional, default: OPENAI_API_KEY)")
+	rootCmd.PersistentFlags().StringVar(&budgetFile, "budget-file", "", "file with spending budgets to enforce and the spend recorded so far (optional, default: none)")
 
 	rootCmd.AddCommand(imageCmd())
 
@@ -39,10 +70,47 @@ func Run() {
 
 	rootCmd.AddCommand(moderationsCmd())
 
+	rootCmd.AddCommand(budgetsCmd())
+
+	rootCmd.AddCommand(serveMockCmd())
+
+	rootCmd.AddCommand(proxyCmd())
+
 	rootCmd.Execute()
 
 }
 
+// newClient creates the OpenAI client configured by the environment and the
+// global flags.
+func newClient(options ...openai.Option) openai.OpenAI {
+	if budgetFile != "" {
+		options = append(options, openai.WithBudgetTracker(loadBudgets()))
+	}
+	if metricsAddr != "" {
+		options = append(options, openai.WithMiddleware(clientMetrics().Middleware()))
+	}
+	if provider := credentialProvider(); provider != nil {
+		options = append(options, openai.WithCredentialProvider(provider))
+	}
+	return openai.NewOpenAI(os.Getenv("OPENAI_API_KEY"), options...)
+}
+
+// credentialProvider returns the provider of the API key configured by the
+// flags, falling back on OPENAI_API_KEY, or nil if no flag is set.
+func credentialProvider() openai.CredentialProvider {
+	var chain openai.ChainCredentials
+	if apiKeyCommand != "" {
+		chain = append(chain, openai.NewCommandCredentials(apiKeyCommandTTL, "sh", "-c", apiKeyCommand))
+	}
+	if apiKeyFile != "" {
+		chain = append(chain, openai.NewFileCredentials(apiKeyFile))
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	return append(chain, openai.EnvCredentials("OPENAI_API_KEY"))
+}
+
 // printResponse prints the response as yaml
 func printResponse(res any) {
 	y, err := yaml.Marshal(res)
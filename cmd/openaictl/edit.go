@@ -68,7 +68,7 @@ func edit(model, instructionFile, instruction, inputFile, input string, n int, t
 		input = string(inputBytes)
 	}
 
-	client := openai.NewOpenAI(os.Getenv("OPENAI_API_KEY"))
+	client := newClient()
 	params := openai.EditRequest{
 		Model:       model,
 		Instruction: instruction,
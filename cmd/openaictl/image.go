@@ -113,7 +113,7 @@ func createImage(prompt string, numImages int, size openai.ImageSize, responseFo
 		fmt.Println("Prompt must be at least 5 characters long")
 		os.Exit(1)
 	}
-	client := openai.NewOpenAI(os.Getenv("OPENAI_API_KEY"))
+	client := newClient()
 	res, err := client.CreateImage(context.Background(), openai.CreateImageReq{
 		Prompt: prompt,
 		CommonImageReq: openai.CommonImageReq{
@@ -138,7 +138,7 @@ func imageVariations(imageFile string, numImages int, size openai.ImageSize, res
 		fmt.Println("Image file does not exist: ", imageFile)
 		os.Exit(1)
 	}
-	client := openai.NewOpenAI(os.Getenv("OPENAI_API_KEY"))
+	client := newClient()
 	res, err := client.CreateImageVariations(context.Background(), openai.CreateImageVariationsReq{
 		Image: imageFile,
 		CommonImageReq: openai.CommonImageReq{
@@ -172,7 +172,7 @@ func imageEdits(imageFile string, prompt string, mask string, numImages int, siz
 		fmt.Println("Prompt must be at least 5 characters long")
 		os.Exit(1)
 	}
-	client := openai.NewOpenAI(os.Getenv("OPENAI_API_KEY"))
+	client := newClient()
 	res, err := client.CreateImageEdits(context.Background(), openai.CreateImageEditsReq{
 		Image:  imageFile,
 		Prompt: prompt,
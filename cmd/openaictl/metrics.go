@@ -0,0 +1,38 @@
+package openaictl
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/noclue/openai/promopenai"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	metricsOnce      sync.Once
+	metricsCollector *promopenai.Collector
+)
+
+// clientMetrics returns the collector of the client metrics. On first use it
+// starts serving the metrics on /metrics at the address set with the
+// --metrics-addr flag of the proxy command. The proxy is the only long-running
+// command that makes API calls; the other commands exit before a scrape.
+func clientMetrics() *promopenai.Collector {
+	metricsOnce.Do(func() {
+		metricsCollector = promopenai.NewCollector()
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(metricsCollector)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		go func() {
+			if err := http.ListenAndServe(metricsAddr, mux); err != nil {
+				fmt.Printf("Error serving metrics: %+v", err)
+				os.Exit(1)
+			}
+		}()
+	})
+	return metricsCollector
+}
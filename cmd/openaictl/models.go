@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/noclue/openai"
 	"github.com/spf13/cobra"
 )
 
@@ -22,7 +21,7 @@ func modelsCmd() *cobra.Command {
 }
 
 func models() {
-	client := openai.NewOpenAI(os.Getenv("OPENAI_API_KEY"))
+	client := newClient()
 	res, err := client.Models(context.Background())
 	if err != nil {
 		fmt.Printf("Error listing models: %s", err)
@@ -0,0 +1,280 @@
+package openaictl
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/noclue/openai"
+)
+
+// reportTextLength is the number of characters of the text of a segment shown
+// in table reports.
+const reportTextLength = 60
+
+// segment is a line or paragraph of a moderated file.
+type segment struct {
+	file string
+	line int
+	text string
+}
+
+// segmentReport is the report of a flagged segment.
+type segmentReport struct {
+	File       string                          `json:"file"`
+	Line       int                             `json:"line"`
+	Flagged    bool                            `json:"flagged"`
+	Action     openai.ModerationAction         `json:"action,omitempty"`
+	Categories []string                        `json:"categories,omitempty"`
+	Scores     openai.ModerationCategoryScores `json:"scores"`
+	Text       string                          `json:"text"`
+}
+
+// moderateFiles moderates the segments of the files of args and prints the
+// report of the flagged segments, or of the segments the policy does not
+// allow. It exits with status 2 if a segment is flagged, or blocked by the
+// policy, and with status 1 if a file is skipped because it is not text.
+func moderateFiles(args []string) {
+	if input != "" || inputFile != "" {
+		fmt.Println("Input and input file cannot be combined with files")
+		os.Exit(1)
+	}
+	if segmentMode != "line" && segmentMode != "paragraph" {
+		fmt.Printf("Invalid mode %s, must be line or paragraph", segmentMode)
+		os.Exit(1)
+	}
+	if reportFormat != "table" && reportFormat != "json" && reportFormat != "csv" {
+		fmt.Printf("Invalid format %s, must be table, json or csv", reportFormat)
+		os.Exit(1)
+	}
+	var segments []segment
+	skipped := 0
+	for _, file := range expandFiles(args) {
+		var data []byte
+		var err error
+		if file == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+		if err != nil {
+			fmt.Printf("Error reading input file: %+v", err)
+			os.Exit(1)
+		}
+		if !utf8.Valid(data) {
+			fmt.Fprintf(os.Stderr, "Skipping %s: not a text file\n", file)
+			skipped++
+			continue
+		}
+		segments = append(segments, splitSegments(file, string(data))...)
+	}
+
+	c := newClient()
+	var engine *openai.ModerationEngine
+	if policyFile != "" {
+		engine = loadPolicy(c)
+	}
+	params := openai.ModerationRequest{Model: model}
+	for _, s := range segments {
+		params.Input = append(params.Input, s.text)
+	}
+	res, err := openai.ModerateChunked(context.Background(), c, params, openai.ChunkOptions{MaxTokens: chunkTokens})
+	if err != nil {
+		fmt.Printf("Error calling moderation: %+v", err)
+		os.Exit(1)
+	}
+	reports := []segmentReport{}
+	failed := false
+	for i, r := range res.Results {
+		s := segments[i]
+		report := segmentReport{
+			File:       s.file,
+			Line:       s.line,
+			Flagged:    r.Result.Flagged,
+			Categories: r.Result.FlaggedCategories(),
+			Scores:     r.Result.CategoryScores,
+			Text:       s.text,
+		}
+		listed := report.Flagged
+		if engine != nil {
+			report.Action = engine.Evaluate(s.text, r.Result).Action
+			listed = report.Action != openai.ActionAllow
+			failed = failed || report.Action == openai.ActionBlock
+		} else {
+			failed = failed || report.Flagged
+		}
+		if listed {
+			reports = append(reports, report)
+		}
+	}
+	if err := writeReport(os.Stdout, reports); err != nil {
+		fmt.Printf("Error writing report: %+v", err)
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(2)
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "%d files were not moderated\n", skipped)
+		os.Exit(1)
+	}
+}
+
+// expandFiles returns the files of args. An arg is - for the standard input,
+// a file, a directory whose files are moderated recursively, skipping hidden
+// files and directories, or a glob matching files or directories. Symbolic
+// links to files are followed; links to directories inside directories are
+// not. Files given more than once are returned once.
+func expandFiles(args []string) []string {
+	var files []string
+	seen := map[string]bool{}
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	for _, arg := range args {
+		paths := []string{arg}
+		if arg != "-" && strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil || len(matches) == 0 {
+				fmt.Printf("No files match %s", arg)
+				os.Exit(1)
+			}
+			paths = matches
+		}
+		for _, path := range paths {
+			if path == "-" {
+				add(path)
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				fmt.Printf("Error reading input files: %+v", err)
+				os.Exit(1)
+			}
+			if !info.IsDir() {
+				if !info.Mode().IsRegular() {
+					fmt.Printf("Input file %s is not a regular file", path)
+					os.Exit(1)
+				}
+				add(path)
+				continue
+			}
+			err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if p != path && strings.HasPrefix(d.Name(), ".") {
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if d.Type()&fs.ModeSymlink != 0 {
+					info, err := os.Stat(p)
+					if err != nil {
+						return err
+					}
+					if info.Mode().IsRegular() {
+						add(p)
+					}
+				} else if d.Type().IsRegular() {
+					add(p)
+				}
+				return nil
+			})
+			if err != nil {
+				fmt.Printf("Error reading input files: %+v", err)
+				os.Exit(1)
+			}
+		}
+	}
+	return files
+}
+
+// splitSegments splits the text of the file into its non-blank lines, or its
+// paragraphs separated by blank lines, depending on segmentMode.
+func splitSegments(file, text string) []segment {
+	var segments []segment
+	var paragraph []string
+	start := 0
+	flush := func() {
+		if len(paragraph) > 0 {
+			segments = append(segments, segment{file: file, line: start, text: strings.Join(paragraph, "\n")})
+			paragraph = nil
+		}
+	}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case segmentMode == "line":
+			segments = append(segments, segment{file: file, line: i + 1, text: line})
+		default:
+			if len(paragraph) == 0 {
+				start = i + 1
+			}
+			paragraph = append(paragraph, line)
+		}
+	}
+	flush()
+	return segments
+}
+
+// writeReport writes the reports in reportFormat.
+func writeReport(w io.Writer, reports []segmentReport) error {
+	switch reportFormat {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	case "csv":
+		cw := csv.NewWriter(w)
+		categories := openai.Categories()
+		header := append([]string{"file", "line", "flagged", "action", "categories"}, categories...)
+		cw.Write(append(header, "text"))
+		for _, r := range reports {
+			record := []string{r.File, strconv.Itoa(r.Line), strconv.FormatBool(r.Flagged), string(r.Action), strings.Join(r.Categories, ";")}
+			for _, category := range categories {
+				record = append(record, strconv.FormatFloat(r.Scores.Get(category), 'f', -1, 64))
+			}
+			cw.Write(append(record, r.Text))
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "FILE\tLINE\tSTATUS\tCATEGORY\tSCORE\tTEXT")
+		for _, r := range reports {
+			status := string(r.Action)
+			if status == "" {
+				status = "flagged"
+			}
+			category, score := openai.ModerationResult{CategoryScores: r.Scores}.MaxCategory()
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%.4f\t%s\n", r.File, r.Line, status, category, score, shortText(r.Text))
+		}
+		return tw.Flush()
+	}
+}
+
+// shortText returns the text on one line, truncated to reportTextLength
+// characters.
+func shortText(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= reportTextLength {
+		return text
+	}
+	return string([]rune(text)[:reportTextLength-3]) + "..."
+}
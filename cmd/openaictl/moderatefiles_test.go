@@ -0,0 +1,105 @@
+package openaictl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/noclue/openai"
+)
+
+func TestExpandFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.md", "sub/c.txt", ".hidden/d.txt", "sub/.e.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+	}
+	link := filepath.Join(t.TempDir(), "link.txt")
+	if err := os.Symlink(filepath.Join(dir, "a.txt"), link); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "b.md"), filepath.Join(dir, "sub", "link.md")); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+
+	files := expandFiles([]string{link, filepath.Join(dir, "*.txt"), dir, "-"})
+	want := []string{
+		link,
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, "b.md"),
+		filepath.Join(dir, "sub", "c.txt"),
+		filepath.Join(dir, "sub", "link.md"),
+		"-",
+	}
+	if fmt.Sprint(files) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, files)
+	}
+}
+
+func TestSplitSegments(t *testing.T) {
+	text := "first\n\nsecond line\r\nthird line\n\n\n  \nlast"
+	tests := []struct {
+		mode string
+		want []segment
+	}{
+		{"line", []segment{{"f", 1, "first"}, {"f", 3, "second line"}, {"f", 4, "third line"}, {"f", 8, "last"}}},
+		{"paragraph", []segment{{"f", 1, "first"}, {"f", 3, "second line\nthird line"}, {"f", 8, "last"}}},
+	}
+	for _, test := range tests {
+		segmentMode = test.mode
+		if got := splitSegments("f", text); fmt.Sprintf("%q", got) != fmt.Sprintf("%q", test.want) {
+			t.Errorf("Expected %q in %v mode, got %q", test.want, test.mode, got)
+		}
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	reports := []segmentReport{{
+		File:       "a.txt",
+		Line:       3,
+		Flagged:    true,
+		Action:     openai.ActionBlock,
+		Categories: []string{openai.CategoryViolence},
+		Scores:     openai.ModerationCategoryScores{Violence: 0.9},
+		Text:       "a bad\nparagraph",
+	}}
+
+	reportFormat = "json"
+	var buf bytes.Buffer
+	if err := writeReport(&buf, reports); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	var decoded []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded) != 1 || decoded[0]["line"] != 3.0 || decoded[0]["action"] != "block" {
+		t.Errorf("Expected JSON report, got %s, %#v", buf.String(), err)
+	}
+
+	reportFormat = "csv"
+	buf.Reset()
+	if err := writeReport(&buf, reports); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	lines := strings.SplitN(buf.String(), "\n", 2)
+	if !strings.HasPrefix(lines[0], "file,line,flagged,action,categories,hate,") ||
+		!strings.HasPrefix(lines[1], "a.txt,3,true,block,violence,0,") || !strings.Contains(lines[1], ",0.9,") {
+		t.Errorf("Expected CSV report, got %s", buf.String())
+	}
+
+	reportFormat = "table"
+	buf.Reset()
+	if err := writeReport(&buf, reports); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if !strings.Contains(buf.String(), "a.txt  3     block   violence  0.9000  a bad paragraph") {
+		t.Errorf("Expected table report, got %s", buf.String())
+	}
+}
@@ -8,27 +8,38 @@ import (
 
 	"github.com/noclue/openai"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 )
 
 // moderationsCmd creates the moderations command to the root command.
 func moderationsCmd() *cobra.Command {
 	var moderationsCmd = &cobra.Command{
-		Use:   "moderation [flags]",
+		Use:   "moderation [flags] [file | directory | glob | -]...",
 		Short: "Given a input text, outputs if the model classifies it as violating OpenAI's content policy.",
-		Long:  `Given a input text, outputs if the model classifies it as violating OpenAI's content policy.`,
-		Args:  cobra.NoArgs,
+		Long:  `Given a input text, outputs if the model classifies it as violating OpenAI's content policy. Given files, the files of directories, files matching globs or - for the standard input, moderates their lines or paragraphs and reports the flagged ones with their file, line and scores as a table, JSON or CSV. Exits with status 2 if any text is flagged, or blocked by the policy if one is given, and with status 1 if a file is not text and cannot be moderated.`,
+		Args:  cobra.ArbitraryArgs,
 		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				moderateFiles(args)
+				return
+			}
 			moderations()
 		},
 	}
 	moderationsCmd.Flags().StringVarP(&input, "input", "i", "", "The text to be moderated")
 	moderationsCmd.Flags().StringVarP(&inputFile, "input-file", "f", "", "The file containing the text to be moderated")
 	moderationsCmd.Flags().StringVarP(&model, "model", "m", "", "The model to use. Defaults to text-moderation-latest")
+	moderationsCmd.Flags().IntVar(&chunkTokens, "chunk-tokens", openai.DefaultChunkTokens, "maximum number of tokens of the chunks the input files are moderated in (optional, default: 1000)")
+	moderationsCmd.Flags().StringVar(&policyFile, "policy", "", "yaml file with the moderation policy to evaluate the results against (optional, default: none)")
+	moderationsCmd.Flags().StringVar(&segmentMode, "mode", "paragraph", "moderate the lines or the paragraphs of files: line or paragraph (optional, default: paragraph)")
+	moderationsCmd.Flags().StringVar(&reportFormat, "format", "table", "format of the report of files: table, json or csv (optional, default: table)")
 	return moderationsCmd
 }
 
-// moderations runs the moderations command.
+// moderations runs the moderations command. Input files are moderated in
+// chunks of at most chunkTokens tokens.
 func moderations() {
+	chunked := false
 	if inputFile != "" && input != "" {
 		fmt.Println("Input and input file are mutually exclusive")
 		os.Exit(1)
@@ -43,6 +54,7 @@ func moderations() {
 			os.Exit(1)
 		}
 		input = string(inputBytes)
+		chunked = true
 	} else if input == "" {
 		fmt.Println("Input or input file is required")
 		os.Exit(1)
@@ -53,11 +65,119 @@ func moderations() {
 	if model != "" {
 		params.Model = model
 	}
-	c := openai.NewOpenAI(os.Getenv("OPENAI_API_KEY"))
-	res, err := c.Moderation(context.Background(), params)
+	c := newClient()
+	var engine *openai.ModerationEngine
+	if policyFile != "" {
+		engine = loadPolicy(c)
+	}
+	if status := moderate(c, engine, params, chunked); status != 0 {
+		os.Exit(status)
+	}
+}
+
+// moderate moderates the input of params, in chunks if chunked, and prints
+// the results, or the decisions of the engine on them if it is not nil. It
+// returns the exit status of the command: 2 if an input is flagged, or
+// blocked by the policy of the engine, and 0 otherwise.
+func moderate(c openai.OpenAI, engine *openai.ModerationEngine, params openai.ModerationRequest, chunked bool) int {
+	switch {
+	case chunked:
+		return moderateChunked(c, engine, params)
+	case engine != nil:
+		decisions, err := engine.Moderate(context.Background(), params)
+		if err != nil {
+			fmt.Printf("Error calling moderation: %+v", err)
+			os.Exit(1)
+		}
+		return printDecisions(decisions)
+	default:
+		res, err := c.Moderation(context.Background(), params)
+		if err != nil {
+			fmt.Printf("Error calling moderation: %+v", err)
+			os.Exit(1)
+		}
+		printResponse(res)
+		for _, r := range res.Results {
+			if r.Flagged {
+				return 2
+			}
+		}
+		return 0
+	}
+}
+
+// chunkedDecision is the decision of a policy on a chunked input with the
+// chunks the policy does not allow.
+type chunkedDecision struct {
+	openai.ModerationDecision `yaml:",inline"`
+	Chunks                    []openai.ModerationChunk `yaml:"chunks,omitempty"`
+}
+
+// moderateChunked moderates the inputs in chunks and prints the merged
+// results, or the decisions of the engine on them if it is not nil. It
+// returns the exit status of the command, as moderate.
+func moderateChunked(c openai.OpenAI, engine *openai.ModerationEngine, params openai.ModerationRequest) int {
+	res, err := openai.ModerateChunked(context.Background(), c, params, openai.ChunkOptions{MaxTokens: chunkTokens})
 	if err != nil {
 		fmt.Printf("Error calling moderation: %+v", err)
 		os.Exit(1)
 	}
-	printResponse(res)
+	if engine == nil {
+		printResponse(res)
+		for _, r := range res.Results {
+			if r.Result.Flagged {
+				return 2
+			}
+		}
+		return 0
+	}
+	var decisions []chunkedDecision
+	blocked := false
+	for i, r := range res.Results {
+		d := chunkedDecision{ModerationDecision: engine.Evaluate(params.Input[i], r.Result)}
+		for _, chunk := range r.Chunks {
+			if engine.Evaluate(params.Input[i][chunk.Start:chunk.End], chunk.Result).Action != openai.ActionAllow {
+				d.Chunks = append(d.Chunks, chunk)
+			}
+		}
+		decisions = append(decisions, d)
+		blocked = blocked || d.Action == openai.ActionBlock
+	}
+	printResponse(decisions)
+	if blocked {
+		return 2
+	}
+	return 0
+}
+
+// loadPolicy creates a moderation engine with the policy of policyFile.
+func loadPolicy(c openai.OpenAI) *openai.ModerationEngine {
+	data, err := os.ReadFile(policyFile)
+	if err != nil {
+		fmt.Printf("Error reading policy file: %+v", err)
+		os.Exit(1)
+	}
+	var policy openai.ModerationPolicy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		fmt.Printf("Error parsing policy file: %+v", err)
+		os.Exit(1)
+	}
+	engine, err := openai.NewModerationEngine(c, policy)
+	if err != nil {
+		fmt.Printf("Error loading policy: %+v", err)
+		os.Exit(1)
+	}
+	return engine
+}
+
+// printDecisions prints the decisions of a policy. It returns the exit
+// status 2 if an input is blocked and 0 otherwise.
+func printDecisions(decisions []openai.ModerationDecision) int {
+	printResponse(decisions)
+	for _, d := range decisions {
+		if d.Action == openai.ActionBlock {
+			return 2
+		}
+	}
+	return 0
 }
@@ -0,0 +1,31 @@
+package openaictl
+
+import (
+	"testing"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaitest"
+)
+
+func TestModerateExitStatus(t *testing.T) {
+	server := openaitest.NewServer(nil)
+	defer server.Close()
+	c := server.OpenAI()
+	params := openai.ModerationRequest{Input: []string{"a bad text"}}
+
+	server.Fake.Respond(openai.OperationModeration, &openai.ModerationResponse{
+		Results: []openai.ModerationResult{{Flagged: true, Categories: openai.ModerationCategories{Violence: true}}},
+	})
+	if status := moderate(c, nil, params, false); status != 2 {
+		t.Errorf("Expected status 2 for a flagged input, got %d", status)
+	}
+	if status := moderate(c, nil, params, false); status != 0 {
+		t.Errorf("Expected status 0 for an input that is not flagged, got %d", status)
+	}
+	server.Fake.Respond(openai.OperationModeration, &openai.ModerationResponse{
+		Results: []openai.ModerationResult{{Flagged: true}},
+	})
+	if status := moderate(c, nil, params, true); status != 2 {
+		t.Errorf("Expected status 2 for a flagged chunked input, got %d", status)
+	}
+}
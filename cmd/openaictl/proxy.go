@@ -0,0 +1,107 @@
+package openaictl
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaiproxy"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// proxyCmd creates the proxy command.
+func proxyCmd() *cobra.Command {
+	var proxyCmd = &cobra.Command{
+		Use:   "proxy",
+		Short: "Serve a proxy of the OpenAI API",
+		Long:  `Serve a proxy of the OpenAI API that forwards requests with the OPENAI_API_KEY, so that clients of the proxy never see the key. Deterministic completions and edits (temperature 0) and moderations are cached by the client of the proxy. Clients can be restricted to the tokens of a yaml clients file mapping client names to the tokens they send as API key; otherwise clients are identified by their IP address. Every client is rate limited and every request is written to the audit log as a line of JSON.`,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			serveProxy()
+		},
+	}
+	proxyCmd.Flags().StringVarP(&addr, "addr", "l", "localhost:8080", "address to listen on (optional, default: localhost:8080)")
+	proxyCmd.Flags().StringVar(&clientsFile, "clients-file", "", "yaml file mapping client names to their tokens (optional, default: any client)")
+	proxyCmd.Flags().Float64Var(&rateLimit, "rate-limit", 0, "requests per second allowed per client (optional, default: unlimited)")
+	proxyCmd.Flags().IntVar(&burst, "burst", 10, "requests a client may send at once above the rate limit (optional, default: 10)")
+	proxyCmd.Flags().IntVar(&cacheSize, "cache-size", 1000, "number of responses to cache, 0 to disable caching (optional, default: 1000)")
+	proxyCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to cache responses in instead of memory (optional, default: none)")
+	proxyCmd.Flags().DurationVar(&cacheTTL, "cache-ttl", time.Hour, "time to cache responses for (optional, default: 1h)")
+	proxyCmd.Flags().StringVar(&auditLog, "audit-log", "-", "file to append the audit log to, - for stdout (optional, default: -)")
+	proxyCmd.Flags().StringVar(&metricsAddr, "metrics-addr", "", "address to serve Prometheus metrics of the forwarded requests on, e.g. :9090 (optional, default: none)")
+	return proxyCmd
+}
+
+func serveProxy() {
+	options := []openaiproxy.Option{openaiproxy.WithAuditLog(openAuditLog())}
+	if clientsFile != "" {
+		clients, err := loadClients(clientsFile)
+		if err != nil {
+			fmt.Printf("Error loading clients file: %+v", err)
+			os.Exit(1)
+		}
+		options = append(options, openaiproxy.WithClients(clients))
+	}
+	if rateLimit > 0 {
+		options = append(options, openaiproxy.WithRateLimit(rateLimit, burst))
+	}
+	var clientOptions []openai.Option
+	switch {
+	case cacheDir != "":
+		store, err := openai.NewDiskCache(cacheDir)
+		if err != nil {
+			fmt.Printf("Error creating cache directory: %+v", err)
+			os.Exit(1)
+		}
+		clientOptions = append(clientOptions, openai.WithCache(store, cacheTTL))
+	case cacheSize > 0:
+		clientOptions = append(clientOptions, openai.WithCache(openai.NewMemoryCache(cacheSize), cacheTTL))
+	}
+	proxy := openaiproxy.New(newClient(clientOptions...), options...)
+	fmt.Fprintf(os.Stderr, "Serving OpenAI API proxy on http://%v\n", addr)
+	if err := http.ListenAndServe(addr, proxy); err != nil {
+		fmt.Printf("Error serving OpenAI API proxy: %+v", err)
+		os.Exit(1)
+	}
+}
+
+func openAuditLog() io.Writer {
+	if auditLog == "-" {
+		return os.Stdout
+	}
+	f, err := os.OpenFile(auditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Printf("Error opening audit log: %+v", err)
+		os.Exit(1)
+	}
+	return f
+}
+
+// loadClients reads the clients file and returns the client names by token.
+// It returns an error if a client has no token or shares the token of
+// another client.
+func loadClients(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tokens map[string]string
+	if err := yaml.Unmarshal(data, &tokens); err != nil {
+		return nil, err
+	}
+	clients := make(map[string]string, len(tokens))
+	for name, token := range tokens {
+		if token == "" {
+			return nil, fmt.Errorf("client %v has no token", name)
+		}
+		if other, ok := clients[token]; ok {
+			return nil, fmt.Errorf("clients %v and %v have the same token", min(name, other), max(name, other))
+		}
+		clients[token] = name
+	}
+	return clients, nil
+}
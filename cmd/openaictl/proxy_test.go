@@ -0,0 +1,29 @@
+package openaictl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadClients(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clients.yaml")
+	if err := os.WriteFile(path, []byte("billing: token-a\nsearch: token-b\n"), 0600); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	clients, err := loadClients(path)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if len(clients) != 2 || clients["token-a"] != "billing" || clients["token-b"] != "search" {
+		t.Errorf("Expected clients by token, got %v", clients)
+	}
+
+	if err := os.WriteFile(path, []byte("billing: token-a\nsearch: token-a\n"), 0600); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if _, err := loadClients(path); err == nil || !strings.Contains(err.Error(), "billing and search") {
+		t.Errorf("Expected error for a duplicate token, got %#v", err)
+	}
+}
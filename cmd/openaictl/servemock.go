@@ -0,0 +1,109 @@
+package openaictl
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaiserver"
+	"github.com/noclue/openai/openaitest"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// serveMockCmd creates the serve-mock command.
+func serveMockCmd() *cobra.Command {
+	var serveMockCmd = &cobra.Command{
+		Use:   "serve-mock",
+		Short: "Serve a local mock of the OpenAI API",
+		Long:  `Serve a local mock of the OpenAI API models, completions, edits, moderations and images endpoints with deterministic responses. Responses of an operation (CreateCompletion, Edit, Moderation, CreateImage, CreateImageVariations, CreateImageEdits or Models) can be replaced with Go templates of the JSON response in a yaml responses file; the templates are executed with the request, e.g. {"choices": [{"text": {{json .Prompt}}}]}. A share of the requests can fail and requests can be delayed to test error handling and timeouts.`,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			serveMock()
+		},
+	}
+	serveMockCmd.Flags().StringVarP(&addr, "addr", "l", "localhost:8080", "address to listen on (optional, default: localhost:8080)")
+	serveMockCmd.Flags().StringVarP(&responsesFile, "responses", "r", "", "yaml file mapping operations to response templates (optional, default: none)")
+	serveMockCmd.Flags().Float64Var(&errorRate, "error-rate", 0, "share of requests between 0 and 1 that fail (optional, default: 0)")
+	serveMockCmd.Flags().IntVar(&errorStatus, "error-status", http.StatusInternalServerError, "HTTP status code of failed requests (optional, default: 500)")
+	serveMockCmd.Flags().DurationVar(&latency, "latency", 0, "delay of every response (optional, default: 0s)")
+	serveMockCmd.Flags().DurationVar(&latencyJitter, "latency-jitter", 0, "maximum random delay added to the latency (optional, default: 0s)")
+	serveMockCmd.Flags().Int64Var(&seed, "seed", 1, "seed of the random failures and delays (optional, default: 1)")
+	return serveMockCmd
+}
+
+func serveMock() {
+	if errorRate < 0 || errorRate > 1 {
+		fmt.Println("Error rate must be between 0 and 1")
+		os.Exit(1)
+	}
+	// The server runs until stopped, so its calls are not recorded.
+	fake := openaitest.NewFake().SetRecording(false)
+	if responsesFile != "" {
+		loadMockResponses(fake, responsesFile)
+	}
+	handler := faultyHandler(openaiserver.NewHandler(fake))
+	fmt.Printf("Serving mock OpenAI API on http://%v\n", addr)
+	if err := http.ListenAndServe(addr, handler); err != nil {
+		fmt.Printf("Error serving mock OpenAI API: %+v", err)
+		os.Exit(1)
+	}
+}
+
+// loadMockResponses sets the response templates of the responses file as the
+// handlers of the fake.
+func loadMockResponses(fake *openaitest.Fake, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("Error reading responses file: %+v", err)
+		os.Exit(1)
+	}
+	var templates map[string]string
+	if err := yaml.Unmarshal(data, &templates); err != nil {
+		fmt.Printf("Error parsing responses file: %+v", err)
+		os.Exit(1)
+	}
+	for operation, tmpl := range templates {
+		handler, err := openaitest.TemplateHandler(operation, tmpl)
+		if err != nil {
+			fmt.Printf("Error in responses file: %+v", err)
+			os.Exit(1)
+		}
+		fake.Handle(operation, handler)
+	}
+}
+
+// faultyHandler delays the responses of next by the configured latency and
+// fails the configured share of requests.
+func faultyHandler(next http.Handler) http.Handler {
+	var mu sync.Mutex
+	random := rand.New(rand.NewSource(seed))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		delay := latency
+		if latencyJitter > 0 {
+			delay += time.Duration(random.Int63n(int64(latencyJitter)))
+		}
+		fail := random.Float64() < errorRate
+		mu.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		if fail {
+			openaiserver.WriteError(w, &openai.APIError{
+				StatusCode: errorStatus,
+				Type:       "server_error",
+				Message:    "Injected failure of the mock OpenAI API",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,162 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// WithRequestCoalescing makes concurrent identical calls of the operations,
+// e.g. OperationModels, share a single HTTP request. Calls are identical if
+// they have the same operation and request JSON and are sent with the same
+// account, i.e. API key, organization, project and headers, as for WithCache.
+// The first call sends the request and the others receive a copy of its
+// response or its error; they have Call.Coalesced set and are neither logged,
+// charged nor recorded. Each caller waits for the shared request only as long
+// as its own context allows. The shared request is not canceled when a
+// caller gives up, but once all callers waiting for it have, so it runs until
+// the latest deadline among them. Without operations, Models and Moderation
+// calls are coalesced.
+func WithRequestCoalescing(operations ...string) Option {
+	if len(operations) == 0 {
+		operations = []string{OperationModels, OperationModeration}
+	}
+	return func(o *openAI) {
+		if o.coalescer == nil {
+			o.coalescer = &coalescer{
+				operations: make(map[string]bool),
+				flights:    make(map[string]*flight),
+			}
+		}
+		for _, op := range operations {
+			o.coalescer.operations[op] = true
+		}
+	}
+}
+
+// coalescer tracks the in-flight calls of the coalesced operations.
+type coalescer struct {
+	operations map[string]bool
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is an in-flight call shared by identical calls.
+type flight struct {
+	done   chan struct{}
+	call   *Call
+	err    error
+	cancel context.CancelFunc
+	// waiters is the number of callers waiting for the call. It is guarded by
+	// the coalescer's mutex.
+	waiters int
+}
+
+// coalescing shares the result of in-flight calls with identical calls. The
+// shared call is sent by the first of them with a context that is not
+// canceled with the caller's, so that a caller giving up does not fail the
+// others. Every caller waits for it only as long as its own context allows,
+// and the call is canceled once no caller waits for it anymore.
+func (o *openAI) coalescing(next Handler) Handler {
+	return func(ctx context.Context, call *Call) error {
+		c := o.coalescer
+		if !c.operations[call.Operation] {
+			return next(ctx, call)
+		}
+		scope, err := o.accountScope(ctx, call)
+		if err != nil {
+			return err
+		}
+		body, err := json.Marshal(call.Request)
+		if err != nil {
+			return next(ctx, call)
+		}
+		key := call.Operation + "\n" + scope + "\n" + string(body)
+
+		c.mu.Lock()
+		f, ok := c.flights[key]
+		if !ok {
+			f = &flight{done: make(chan struct{}), call: &Call{
+				Operation:      call.Operation,
+				Request:        shallowCopy(call.Request),
+				Response:       reflect.New(reflect.TypeOf(call.Response).Elem()).Interface(),
+				IdempotencyKey: call.IdempotencyKey,
+				apiKey:         call.apiKey,
+			}}
+			shared, cancel := context.WithCancel(context.WithoutCancel(ctx))
+			f.cancel = cancel
+			c.flights[key] = f
+			go func() {
+				f.err = next(shared, f.call)
+				c.mu.Lock()
+				c.forget(key, f)
+				c.mu.Unlock()
+				cancel()
+				close(f.done)
+			}()
+		}
+		f.waiters++
+		c.mu.Unlock()
+
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			c.mu.Lock()
+			f.waiters--
+			if f.waiters == 0 {
+				c.forget(key, f)
+				f.cancel()
+			}
+			c.mu.Unlock()
+			return ctx.Err()
+		}
+		return f.share(call, ok)
+	}
+}
+
+// forget removes the flight from the in-flight calls, so that later identical
+// calls send a request of their own. The caller must hold c.mu.
+func (c *coalescer) forget(key string, f *flight) {
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+}
+
+// share copies the result of the flight to the call, which is coalesced if it
+// did not start the flight.
+func (f *flight) share(call *Call, coalesced bool) error {
+	call.Coalesced = coalesced
+	call.Method = f.call.Method
+	call.Endpoint = f.call.Endpoint
+	call.StatusCode = f.call.StatusCode
+	call.Header = f.call.Header.Clone()
+	call.RequestID = f.call.RequestID
+	call.IdempotencyKey = f.call.IdempotencyKey
+	if !coalesced {
+		call.Attempts = f.call.Attempts
+		call.CacheHit = f.call.CacheHit
+		call.Hedged = f.call.Hedged
+	}
+	if f.err != nil {
+		return f.err
+	}
+	body, err := json.Marshal(f.call.Response)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, call.Response)
+}
+
+// shallowCopy returns a pointer to a copy of the value v points to, or nil if
+// v is nil.
+func shallowCopy(v any) any {
+	if v == nil {
+		return nil
+	}
+	ptr := reflect.ValueOf(v)
+	res := reflect.New(ptr.Type().Elem())
+	res.Elem().Set(ptr.Elem())
+	return res.Interface()
+}
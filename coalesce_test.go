@@ -0,0 +1,239 @@
+package openai_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaitest"
+)
+
+// coalesced counts the coalesced calls passing through the middleware.
+func coalesced(mu *sync.Mutex, n *int) openai.Middleware {
+	return func(next openai.Handler) openai.Handler {
+		return func(ctx context.Context, call *openai.Call) error {
+			err := next(ctx, call)
+			if call.Coalesced {
+				mu.Lock()
+				*n++
+				mu.Unlock()
+			}
+			return err
+		}
+	}
+}
+
+// gate makes the handled calls wait until release is closed. started is
+// closed once the first call waits.
+func gate(handler openaitest.HandlerFunc) (h openaitest.HandlerFunc, started, release chan struct{}) {
+	started, release = make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	return func(ctx context.Context, request any) (any, error) {
+		once.Do(func() { close(started) })
+		<-release
+		return handler(ctx, request)
+	}, started, release
+}
+
+func TestRequestCoalescing(t *testing.T) {
+	t.Parallel()
+	handler, started, release := gate(func(ctx context.Context, request any) (any, error) {
+		return openaitest.DefaultResponse(openai.OperationModels, request)
+	})
+	server := openaitest.NewServer(openaitest.NewFake().Handle(openai.OperationModels, handler))
+	defer server.Close()
+	var mu sync.Mutex
+	var shared int
+	client := server.OpenAI(openai.WithMiddleware(coalesced(&mu, &shared)), openai.WithRequestCoalescing())
+
+	const n = 5
+	var ready, done sync.WaitGroup
+	for i := 0; i < n; i++ {
+		ready.Add(2)
+		done.Add(2)
+		go func() {
+			defer done.Done()
+			ready.Done()
+			if res, err := client.Models(context.Background()); err != nil || len(res.Data) != len(openaitest.Models) {
+				t.Errorf("Expected models, got %#v, %#v", res, err)
+			}
+		}()
+		go func() {
+			defer done.Done()
+			ready.Done()
+			if _, err := client.Edit(context.Background(), openai.EditRequest{Input: "a"}); err != nil {
+				t.Errorf("Expected nil, got %#v", err)
+			}
+		}()
+	}
+	ready.Wait()
+	<-started
+	close(release)
+	done.Wait()
+
+	// Every call found the first one in flight or sent its own.
+	calls := len(server.Fake.Calls(openai.OperationModels))
+	if calls < 1 || calls >= n || calls+shared != n {
+		t.Errorf("Expected %d calls to share fewer requests, got %d requests and %d shared calls", n, calls, shared)
+	}
+	server.Fake.AssertCalled(t, openai.OperationEdit, n)
+}
+
+func TestRequestCoalescingError(t *testing.T) {
+	t.Parallel()
+	handler, started, release := gate(func(ctx context.Context, request any) (any, error) {
+		return nil, openaitest.APIError(http.StatusServiceUnavailable, "server_error", "overloaded")
+	})
+	server := openaitest.NewServer(openaitest.NewFake().Handle(openai.OperationCreateCompletion, handler))
+	defer server.Close()
+	client := server.OpenAI(openai.WithRequestCoalescing(openai.OperationCreateCompletion))
+
+	var ready, done sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		ready.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			ready.Done()
+			_, err := client.CreateCompletion(context.Background(), openai.CompletionsRequest{Prompt: "a"})
+			var apiErr *openai.APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("Expected shared 503 error, got %#v", err)
+			}
+		}()
+	}
+	ready.Wait()
+	<-started
+	close(release)
+	done.Wait()
+}
+
+// waitingContext signals when a call with the context starts waiting for a
+// shared request, which is the first time its Done channel is taken.
+type waitingContext struct {
+	context.Context
+	waiting chan struct{}
+	once    sync.Once
+}
+
+func newWaitingContext(ctx context.Context) *waitingContext {
+	return &waitingContext{Context: ctx, waiting: make(chan struct{})}
+}
+
+func (c *waitingContext) Done() <-chan struct{} {
+	c.once.Do(func() { close(c.waiting) })
+	return c.Context.Done()
+}
+
+// blockingClient passes the requests it receives to requests, and answers
+// them with an empty model list once release is closed, or fails them once
+// their context is done.
+type blockingClient struct {
+	requests chan *http.Request
+	release  chan struct{}
+}
+
+func newBlockingClient() *blockingClient {
+	return &blockingClient{requests: make(chan *http.Request, 10), release: make(chan struct{})}
+}
+
+func (c *blockingClient) Do(req *http.Request) (*http.Response, error) {
+	c.requests <- req
+	select {
+	case <-c.release:
+		return jsonResponse(http.StatusOK, `{"object": "list", "data": []}`), nil
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+}
+
+func TestRequestCoalescingCancel(t *testing.T) {
+	t.Parallel()
+	httpClient := newBlockingClient()
+	client := openai.NewOpenAI(apiKey, openai.WithHttpClient(httpClient), openai.WithRequestCoalescing())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := client.Models(ctx)
+		first <- err
+	}()
+	req := <-httpClient.requests
+	follower := newWaitingContext(context.Background())
+	second := make(chan error)
+	go func() {
+		_, err := client.Models(follower)
+		second <- err
+	}()
+	<-follower.waiting
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected canceled first call, got %#v", err)
+	}
+	// The follower still waits, so the shared request is not canceled.
+	if err := req.Context().Err(); err != nil {
+		t.Errorf("Expected the shared request to outlive the canceled caller, got %#v", err)
+	}
+	canceled, cancelLate := context.WithCancel(context.Background())
+	cancelLate()
+	if _, err := client.Models(canceled); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected canceled late caller, got %#v", err)
+	}
+	close(httpClient.release)
+	if err := <-second; err != nil {
+		t.Errorf("Expected follower to succeed, got %#v", err)
+	}
+	if n := len(httpClient.requests); n != 0 {
+		t.Errorf("Expected a single shared request, got %d more", n)
+	}
+}
+
+func TestRequestCoalescingAbandoned(t *testing.T) {
+	t.Parallel()
+	httpClient := newBlockingClient()
+	client := openai.NewOpenAI(apiKey, openai.WithHttpClient(httpClient), openai.WithRequestCoalescing())
+
+	// The shared request outlives the deadline of a follower while the first
+	// caller still waits for it.
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := client.Models(ctx)
+		first <- err
+	}()
+	req := <-httpClient.requests
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelTimeout()
+	if _, err := client.Models(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the follower to time out, got %#v", err)
+	}
+	if err := req.Context().Err(); err != nil {
+		t.Errorf("Expected the shared request to outlive the follower's deadline, got %#v", err)
+	}
+
+	// Once every caller has given up, the shared request is canceled and
+	// later calls send a request of their own.
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected canceled first call, got %#v", err)
+	}
+	select {
+	case <-req.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the abandoned shared request to be canceled")
+	}
+	second := make(chan error)
+	go func() {
+		_, err := client.Models(context.Background())
+		second <- err
+	}()
+	<-httpClient.requests
+	close(httpClient.release)
+	if err := <-second; err != nil {
+		t.Errorf("Expected a new request to succeed, got %#v", err)
+	}
+}
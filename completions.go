@@ -5,7 +5,7 @@ import (
 	"fmt"
 )
 
-var completionsPath = fmt.Sprintf("%v/%v/completions", basePath, apiVersion)
+var completionsPath = fmt.Sprintf("/%v/completions", apiVersion)
 
 type LogitBias map[string]int8
 
@@ -116,10 +116,12 @@ type CompletionsResponse struct {
 }
 
 func (c *openAI) CreateCompletion(ctx context.Context, req CompletionsRequest) (*CompletionsResponse, error) {
-	var resp CompletionsResponse
-	err := c.makeJSONRequest(ctx, completionsPath, req, &resp)
+	call := &Call{Operation: OperationCreateCompletion, Request: &req, Response: &CompletionsResponse{}}
+	err := c.invoke(ctx, call, func(ctx context.Context, call *Call) error {
+		return c.makeJSONRequest(ctx, completionsPath, call.Request, call.Response)
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &resp, nil
+	return call.Response.(*CompletionsResponse), nil
 }
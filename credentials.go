@@ -0,0 +1,177 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoCredentials is the error returned by credential providers that have no
+// API key.
+var ErrNoCredentials = errors.New("openai: no credentials")
+
+// CredentialProvider provides the API key of requests. It is consulted once
+// for every call of the client, whose requests, retries included, are all
+// sent with the key, so keys can be rotated without recreating the client.
+// Implementations must be safe for concurrent use.
+type CredentialProvider interface {
+	// APIKey returns the API key to send.
+	APIKey(ctx context.Context) (string, error)
+}
+
+// WithCredentialProvider makes the client get the API key of every call
+// from provider instead of using the key it was created with. Keys of a key
+// pool take precedence, and the provider is only consulted for requests the
+// pool has no key for. Budgets scoped to API keys apply to the key provided.
+func WithCredentialProvider(provider CredentialProvider) Option {
+	return func(o *openAI) {
+		o.credentials = provider
+	}
+}
+
+// apiKey returns the API key of a request made with the context.
+func (o *openAI) apiKey(ctx context.Context) (string, error) {
+	if o.credentials == nil {
+		return o.APIKey, nil
+	}
+	key, err := o.credentials.APIKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("openai: credentials error: %w", err)
+	}
+	return key, nil
+}
+
+// callAPIKey returns the API key of the requests of the call. It is provided
+// once per call, so that the cache and coalescing scopes of the call and all
+// its requests use the same key.
+func (o *openAI) callAPIKey(ctx context.Context, call *Call) (string, error) {
+	if call == nil {
+		return o.apiKey(ctx)
+	}
+	if call.apiKey == "" {
+		key, err := o.apiKey(ctx)
+		if err != nil {
+			return "", err
+		}
+		call.apiKey = key
+	}
+	return call.apiKey, nil
+}
+
+// EnvCredentials provides the API key in the environment variable it names,
+// e.g. EnvCredentials("OPENAI_API_KEY").
+type EnvCredentials string
+
+// APIKey implements CredentialProvider.
+func (e EnvCredentials) APIKey(ctx context.Context) (string, error) {
+	if key := os.Getenv(string(e)); key != "" {
+		return key, nil
+	}
+	return "", fmt.Errorf("%w: environment variable %v is not set", ErrNoCredentials, string(e))
+}
+
+// FileCredentials provides the API key stored in a file, e.g. a mounted
+// secret. The file is read again when its modification time or size changes.
+// Surrounding whitespace is ignored.
+type FileCredentials struct {
+	path string
+
+	mu      sync.Mutex
+	key     string
+	modTime time.Time
+	size    int64
+}
+
+// NewFileCredentials creates a provider of the API key in the file.
+func NewFileCredentials(path string) *FileCredentials {
+	return &FileCredentials{path: path}
+}
+
+// APIKey implements CredentialProvider.
+func (f *FileCredentials) APIKey(ctx context.Context) (string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.key != "" && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.key, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("%w: file %v is empty", ErrNoCredentials, f.path)
+	}
+	f.key, f.modTime, f.size = key, info.ModTime(), info.Size()
+	return key, nil
+}
+
+// CommandCredentials provides the API key printed by a command, e.g. a
+// password manager CLI. The key is cached for a time to live. Surrounding
+// whitespace is ignored.
+type CommandCredentials struct {
+	ttl  time.Duration
+	name string
+	args []string
+
+	mu      sync.Mutex
+	key     string
+	expires time.Time
+}
+
+// NewCommandCredentials creates a provider of the API key printed by the
+// command with the arguments. The command is run again once the key is older
+// than ttl, or for every call if ttl is zero.
+func NewCommandCredentials(ttl time.Duration, name string, args ...string) *CommandCredentials {
+	return &CommandCredentials{ttl: ttl, name: name, args: args}
+}
+
+// APIKey implements CredentialProvider.
+func (c *CommandCredentials) APIKey(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.key != "" && time.Now().Before(c.expires) {
+		return c.key, nil
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.name, c.args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("command %v failed: %w: %s", c.name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	key := strings.TrimSpace(string(out))
+	if key == "" {
+		return "", fmt.Errorf("%w: command %v printed no key", ErrNoCredentials, c.name)
+	}
+	c.key, c.expires = key, time.Now().Add(c.ttl)
+	return key, nil
+}
+
+// ChainCredentials provides the API key of the first of its providers that
+// has one.
+type ChainCredentials []CredentialProvider
+
+// APIKey implements CredentialProvider. If no provider has a key, the errors
+// of all providers are returned.
+func (c ChainCredentials) APIKey(ctx context.Context) (string, error) {
+	errs := []error{ErrNoCredentials}
+	for _, provider := range c {
+		key, err := provider.APIKey(ctx)
+		if err == nil {
+			return key, nil
+		}
+		errs = append(errs, err)
+	}
+	return "", errors.Join(errs...)
+}
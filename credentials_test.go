@@ -0,0 +1,153 @@
+package openai_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaitest"
+)
+
+func TestCredentialProvider(t *testing.T) {
+	t.Parallel()
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte("sk-first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	client := openai.NewOpenAI("sk-static", openai.WithBaseURL(server.URL), openai.WithCredentialProvider(openai.NewFileCredentials(path)))
+
+	if _, err := client.Models(context.Background()); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if err := os.WriteFile(path, []byte("sk-rotated\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Models(context.Background()); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if len(keys) != 2 || keys[0] != "Bearer sk-first" || keys[1] != "Bearer sk-rotated" {
+		t.Errorf("Expected first and rotated keys, got %v", keys)
+	}
+
+	os.Remove(path)
+	if _, err := client.Models(context.Background()); err == nil {
+		t.Error("Expected error for missing key file, got nil")
+	}
+	if len(keys) != 2 {
+		t.Errorf("Expected no request without key, got %v", keys)
+	}
+}
+
+// rotatingCredentials provides a new API key every time it is consulted.
+type rotatingCredentials struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (r *rotatingCredentials) APIKey(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.n++
+	return "sk-" + strconv.Itoa(r.n), nil
+}
+
+func TestCredentialProviderOncePerCall(t *testing.T) {
+	t.Parallel()
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "modr-1", "model": "text-moderation-004", "results": [{"flagged": false}]}`))
+	}))
+	defer server.Close()
+	provider := &rotatingCredentials{}
+	client := openai.NewOpenAI("sk-static", openai.WithBaseURL(server.URL), openai.WithCredentialProvider(provider),
+		openai.WithCache(openai.NewMemoryCache(10), time.Hour), openai.WithRequestCoalescing(openai.OperationModeration))
+	req := openai.ModerationRequest{Input: []string{"a"}}
+
+	// Each call is scoped to and sent with the one key provided for it, so
+	// the rotated key of the second call misses the cache of the first.
+	for i := 0; i < 2; i++ {
+		ctx, md := openai.WithResponseMetadata(context.Background())
+		if _, err := client.Moderation(ctx, req); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+		if md.CacheHit {
+			t.Errorf("Expected cache miss for call %d", i)
+		}
+	}
+	if provider.n != 2 {
+		t.Errorf("Expected the provider to be consulted once per call, got %d times", provider.n)
+	}
+	if len(keys) != 2 || keys[0] != "Bearer sk-1" || keys[1] != "Bearer sk-2" {
+		t.Errorf("Expected the keys of the calls, got %v", keys)
+	}
+}
+
+func TestCredentialProviderBudgets(t *testing.T) {
+	t.Parallel()
+	server := openaitest.NewServer(openaitest.NewFake())
+	defer server.Close()
+	tracker, err := openai.NewBudgetTracker(filepath.Join(t.TempDir(), "budgets.json"), openai.DefaultPricing,
+		openai.Budget{Name: "per-key", Scope: openai.BudgetScopeAPIKey, Key: "sk-provided", Period: openai.Daily, MaxTokens: 6}) // the estimate of one edit
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte("sk-provided\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	client := openai.NewOpenAI("sk-static", openai.WithBaseURL(server.URL),
+		openai.WithCredentialProvider(openai.NewFileCredentials(path)), openai.WithBudgetTracker(tracker))
+	req := openai.EditRequest{Input: "blah-blah"}
+	if _, err := client.Edit(context.Background(), req); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if _, err := client.Edit(context.Background(), req); !errors.Is(err, openai.ErrBudgetExceeded) {
+		t.Errorf("Expected the provided key to be charged, got %#v", err)
+	}
+}
+
+func TestCredentialProviders(t *testing.T) {
+	t.Setenv("OPENAI_TEST_KEY", "sk-env")
+	ctx := context.Background()
+	if key, err := openai.EnvCredentials("OPENAI_TEST_KEY").APIKey(ctx); err != nil || key != "sk-env" {
+		t.Errorf("Expected sk-env, got %q, %#v", key, err)
+	}
+	if _, err := openai.EnvCredentials("OPENAI_TEST_MISSING").APIKey(ctx); !errors.Is(err, openai.ErrNoCredentials) {
+		t.Errorf("Expected ErrNoCredentials, got %#v", err)
+	}
+	if key, err := openai.NewCommandCredentials(0, "echo", "sk-command").APIKey(ctx); err != nil || key != "sk-command" {
+		t.Errorf("Expected sk-command, got %q, %#v", key, err)
+	}
+	if _, err := openai.NewCommandCredentials(0, "false").APIKey(ctx); err == nil {
+		t.Error("Expected error for failing command, got nil")
+	}
+
+	chain := openai.ChainCredentials{
+		openai.EnvCredentials("OPENAI_TEST_MISSING"),
+		openai.NewFileCredentials(filepath.Join(t.TempDir(), "missing")),
+		openai.EnvCredentials("OPENAI_TEST_KEY"),
+	}
+	if key, err := chain.APIKey(ctx); err != nil || key != "sk-env" {
+		t.Errorf("Expected sk-env, got %q, %#v", key, err)
+	}
+	if _, err := chain[:2].APIKey(ctx); !errors.Is(err, openai.ErrNoCredentials) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected errors of all providers, got %#v", err)
+	}
+}
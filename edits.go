@@ -5,7 +5,7 @@ import (
 	"fmt"
 )
 
-var createEditPath = fmt.Sprintf("%v/%v/edits", basePath, apiVersion)
+var createEditPath = fmt.Sprintf("/%v/edits", apiVersion)
 
 // EditRequest is the request to create an edit.
 type EditRequest struct {
@@ -44,10 +44,12 @@ type EditResponse struct {
 // Edit creates an edit. Given a prompt and an instruction, the model
 // will return an edited version of the prompt.
 func (c *openAI) Edit(ctx context.Context, req EditRequest) (*EditResponse, error) {
-	var res EditResponse
-	err := c.makeJSONRequest(ctx, createEditPath, req, &res)
+	call := &Call{Operation: OperationEdit, Request: &req, Response: &EditResponse{}}
+	err := c.invoke(ctx, call, func(ctx context.Context, call *Call) error {
+		return c.makeJSONRequest(ctx, createEditPath, call.Request, call.Response)
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &res, nil
+	return call.Response.(*EditResponse), nil
 }
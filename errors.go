@@ -13,10 +13,15 @@ var ErrDecodingResponse = errors.New("openai: cannot decode error response")
 
 // APIError is the error returned from the OpenAI API
 type APIError struct {
-	Code    any    `json:"code"`
-	Message string `json:"message"`
-	Details string `json:"param"`
-	Type    string `json:"type"`
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int    `json:"-"`
+	Code       any    `json:"code"`
+	Message    string `json:"message"`
+	Details    string `json:"param"`
+	Type       string `json:"type"`
+
+	// err is the error the API error wraps, if any.
+	err error
 }
 
 // Error returns the error message
@@ -24,18 +29,30 @@ func (e *APIError) Error() string {
 	return "openai: API error:" + e.Message
 }
 
+// Unwrap returns ErrDecodingResponse for error responses whose body could not
+// be decoded and nil otherwise.
+func (e *APIError) Unwrap() error {
+	return e.err
+}
+
 // openAIAPIError represents the JSON payload returned from the OpenAI API
 type openAIAPIError struct {
 	Error *APIError `json:"error"`
 }
 
-// checkErrResponse unmarshals the http response body into an error.
+// checkErrResponse unmarshals the http response body into an error. Error
+// responses that are not JSON, such as the HTML pages of gateways, or cannot
+// be decoded still return an *APIError with the status code of the response
+// that wraps ErrDecodingResponse.
 func checkErrResponse(resp *http.Response) error {
 	if resp.StatusCode >= http.StatusOK && resp.StatusCode < 300 {
 		return nil
 	}
 	if err := checkJSONContentType(resp); err != nil {
-		return err
+		if resp.Body != nil {
+			resp.Body.Close()
+		}
+		return undecodedError(resp.StatusCode)
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
@@ -46,8 +63,80 @@ func checkErrResponse(resp *http.Response) error {
 	openAIErr := openAIAPIError{}
 	if err := json.Unmarshal(body, &openAIErr); err == nil &&
 		openAIErr.Error != nil && openAIErr.Error.Message != "" {
+		openAIErr.Error.StatusCode = resp.StatusCode
 		return openAIErr.Error
 	}
 
-	return fmt.Errorf("openai: cannot read error response with status code: %v. %w", resp.StatusCode, ErrDecodingResponse)
+	return undecodedError(resp.StatusCode)
+}
+
+// undecodedError returns the API error of an error response with the status
+// code whose body cannot be decoded.
+func undecodedError(statusCode int) *APIError {
+	return &APIError{
+		StatusCode: statusCode,
+		Message:    fmt.Sprintf("cannot read error response with status code: %v", statusCode),
+		err:        ErrDecodingResponse,
+	}
+}
+
+// ErrBudgetExceeded is the error returned when a request would exceed a
+// spending budget. The request is not sent.
+var ErrBudgetExceeded = errors.New("openai: budget exceeded")
+
+// BudgetExceededError describes the budget a request would exceed. It wraps
+// ErrBudgetExceeded.
+type BudgetExceededError struct {
+	// Budget is the name of the exceeded budget.
+	Budget string
+	// Subject is the user or API key fingerprint the spend is accounted to.
+	Subject string
+	// Unit is the unit of the limit: "usd" or "tokens".
+	Unit string
+	// Limit is the budget limit.
+	Limit float64
+	// Spent is the spend in the current budget period.
+	Spent float64
+	// Requested is the estimated spend of the refused request.
+	Requested float64
+}
+
+// Error returns the error message
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("%v: %v: spent %v of %v %v, request needs %v", ErrBudgetExceeded, e.Budget, e.Spent, e.Limit, e.Unit, e.Requested)
+}
+
+// Unwrap returns ErrBudgetExceeded
+func (e *BudgetExceededError) Unwrap() error {
+	return ErrBudgetExceeded
+}
+
+// ErrUnknownPrice is the error returned when a request is subject to a cost
+// budget but its model has no price. The request is not sent.
+var ErrUnknownPrice = errors.New("openai: unknown price")
+
+// UnknownPriceError describes the budget that refused a request to a model
+// without a price. It wraps ErrUnknownPrice.
+type UnknownPriceError struct {
+	// Budget is the name of the budget that limits cost.
+	Budget string
+	// Model is the model missing from the price table.
+	Model string
+	// Size is the image size missing from the price table for image
+	// requests, whose price depends on the size only. It is empty for other
+	// requests.
+	Size ImageSize
+}
+
+// Error returns the error message
+func (e *UnknownPriceError) Error() string {
+	if e.Size != "" {
+		return fmt.Sprintf("%v: %v: no price for image size %q", ErrUnknownPrice, e.Budget, e.Size)
+	}
+	return fmt.Sprintf("%v: %v: no price for model %q", ErrUnknownPrice, e.Budget, e.Model)
+}
+
+// Unwrap returns ErrUnknownPrice
+func (e *UnknownPriceError) Unwrap() error {
+	return ErrUnknownPrice
 }
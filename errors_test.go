@@ -86,3 +86,22 @@ func TestCheckErrResponse(t *testing.T) {
 		}
 	})
 }
+
+func TestCheckErrResponseNotJSON(t *testing.T) {
+	t.Parallel()
+	resp := &http.Response{
+		StatusCode: http.StatusBadGateway,
+		Header: http.Header{
+			"Content-Type": []string{"text/html"},
+		},
+		Body: io.NopCloser(strings.NewReader("<html><body>502 Bad Gateway</body></html>")),
+	}
+	err := checkErrResponse(resp)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected API error with status code 502 but got: %#v", err)
+	}
+	if !errors.Is(err, ErrDecodingResponse) {
+		t.Errorf("expected ErrDecodingResponse error but got: %#v", err)
+	}
+}
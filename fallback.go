@@ -0,0 +1,131 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ErrorClass is a class of errors that can trigger a model fallback.
+type ErrorClass string
+
+const (
+	// ErrorClassRateLimit is a 429 response other than an exhausted quota.
+	ErrorClassRateLimit ErrorClass = "rate_limit"
+	// ErrorClassServer is a 5xx response, e.g. an overloaded model.
+	ErrorClassServer ErrorClass = "server"
+	// ErrorClassTimeout is a timeout of the HTTP client.
+	ErrorClassTimeout ErrorClass = "timeout"
+	// ErrorClassModelNotFound is a 404 response, e.g. for a retired model.
+	ErrorClassModelNotFound ErrorClass = "model_not_found"
+)
+
+// defaultFallbackClasses are the error classes triggering a fallback if a
+// policy names none.
+var defaultFallbackClasses = []ErrorClass{ErrorClassRateLimit, ErrorClassServer, ErrorClassTimeout}
+
+// FallbackPolicy is an ordered list of models to fall back on.
+type FallbackPolicy struct {
+	// Models is the ordered list of models. A completions or edits call of a
+	// model of the list that fails with an error of one of the classes On is
+	// retried with the next model of the list.
+	Models []string `json:"models" yaml:"models"`
+	// On is the list of error classes triggering a fallback. It defaults to
+	// ErrorClassRateLimit, ErrorClassServer and ErrorClassTimeout.
+	On []ErrorClass `json:"on,omitempty" yaml:"on,omitempty"`
+}
+
+// WithFallback adds model fallback policies to the client. The model that
+// answered a call is reported by Call.Model once the call returns and in
+// ResponseMetadata.Model. Every model tried is cached, logged, charged and
+// recorded like a call of its own.
+func WithFallback(policies ...FallbackPolicy) Option {
+	return func(o *openAI) {
+		o.fallbacks = append(o.fallbacks, policies...)
+	}
+}
+
+// fallbackModels returns the models to fall back on after model fails and the
+// error classes triggering the fallback.
+func (o *openAI) fallbackModels(model string) ([]string, []ErrorClass) {
+	for _, policy := range o.fallbacks {
+		for i, m := range policy.Models {
+			if m != model {
+				continue
+			}
+			on := policy.On
+			if len(on) == 0 {
+				on = defaultFallbackClasses
+			}
+			return policy.Models[i+1:], on
+		}
+	}
+	return nil, nil
+}
+
+// fallback retries failed completions and edits calls with the fallback
+// models of their model.
+func (o *openAI) fallback(next Handler) Handler {
+	return func(ctx context.Context, call *Call) error {
+		var setModel func(string)
+		switch req := call.Request.(type) {
+		case *CompletionsRequest:
+			setModel = func(model string) { req.Model = model }
+		case *EditRequest:
+			setModel = func(model string) { req.Model = model }
+		default:
+			return next(ctx, call)
+		}
+		models, on := o.fallbackModels(call.Model())
+		err := next(ctx, call)
+		key := call.IdempotencyKey
+		for _, model := range models {
+			if err == nil || ctx.Err() != nil || !matchesErrorClass(err, on) {
+				break
+			}
+			setModel(model)
+			call.IdempotencyKey = derivedIdempotencyKey(key, model)
+			err = next(ctx, call)
+		}
+		return err
+	}
+}
+
+// matchesErrorClass reports whether the error belongs to one of the classes.
+func matchesErrorClass(err error, classes []ErrorClass) bool {
+	class, ok := classifyError(err)
+	if !ok {
+		return false
+	}
+	for _, c := range classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyError returns the class of the error, if it has one. Errors other
+// than timeouts and API errors have no class, whatever the status of the
+// last response of the call, which may be left from an earlier attempt.
+func classifyError(err error) (ErrorClass, bool) {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrorClassTimeout, true
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code == "insufficient_quota" || apiErr.Type == "insufficient_quota" {
+		return "", false
+	}
+	switch status := apiErr.StatusCode; {
+	case status == http.StatusTooManyRequests:
+		return ErrorClassRateLimit, true
+	case status >= http.StatusInternalServerError:
+		return ErrorClassServer, true
+	case status == http.StatusNotFound:
+		return ErrorClassModelNotFound, true
+	default:
+		return "", false
+	}
+}
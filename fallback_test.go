@@ -0,0 +1,115 @@
+package openai_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaiserver"
+	"github.com/noclue/openai/openaitest"
+)
+
+func TestFallback(t *testing.T) {
+	t.Parallel()
+	server := openaitest.NewServer(nil)
+	defer server.Close()
+	client := server.OpenAI(openai.WithFallback(
+		openai.FallbackPolicy{Models: []string{"text-davinci-003", "text-curie-001", "text-babbage-001"}},
+		openai.FallbackPolicy{Models: []string{"text-davinci-edit-001", "code-davinci-edit-001"}, On: []openai.ErrorClass{openai.ErrorClassModelNotFound}},
+	))
+	server.Fake.
+		Fail(openai.OperationCreateCompletion, openaitest.APIError(http.StatusServiceUnavailable, "server_error", "That model is currently overloaded")).
+		Fail(openai.OperationCreateCompletion, openaitest.APIError(http.StatusTooManyRequests, "requests", "Rate limit reached"))
+
+	ctx, md := openai.WithResponseMetadata(context.Background())
+	res, err := client.CreateCompletion(ctx, openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "Say this is a test"})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if md.Model != "text-babbage-001" || res.Model != "text-babbage-001" {
+		t.Errorf("Expected text-babbage-001, got %v and %v", md.Model, res.Model)
+	}
+	server.Fake.AssertCalled(t, openai.OperationCreateCompletion, 3)
+
+	server.Fake.Fail(openai.OperationEdit, openaitest.APIError(http.StatusNotFound, "invalid_request_error", "The model does not exist"))
+	ctx, md = openai.WithResponseMetadata(context.Background())
+	if _, err := client.Edit(ctx, openai.EditRequest{Model: "text-davinci-edit-001", Input: "a"}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if md.Model != "code-davinci-edit-001" {
+		t.Errorf("Expected code-davinci-edit-001, got %v", md.Model)
+	}
+
+	server.Fake.Fail(openai.OperationEdit, openaitest.APIError(http.StatusServiceUnavailable, "server_error", "overloaded"))
+	_, err = client.Edit(context.Background(), openai.EditRequest{Model: "text-davinci-edit-001", Input: "a"})
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 error without fallback, got %#v", err)
+	}
+	server.Fake.AssertCalled(t, openai.OperationEdit, 3)
+
+	server.Fake.Fail(openai.OperationCreateCompletion, openaitest.APIError(http.StatusBadRequest, "invalid_request_error", "bad request"))
+	if _, err := client.CreateCompletion(context.Background(), openai.CompletionsRequest{Model: "text-davinci-003"}); err == nil {
+		t.Error("Expected error without fallback, got nil")
+	}
+	server.Fake.AssertCalled(t, openai.OperationCreateCompletion, 4)
+}
+
+func TestFallbackHTMLError(t *testing.T) {
+	t.Parallel()
+	// The first request fails with the HTML page of an overloaded gateway.
+	var requests atomic.Int32
+	handler := openaiserver.NewHandler(openaitest.NewFake())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("<html><body><h1>503 Service Temporarily Unavailable</h1></body></html>"))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	client := openai.NewOpenAI("sk-test", openai.WithBaseURL(server.URL), openai.WithFallback(
+		openai.FallbackPolicy{Models: []string{"text-davinci-003", "text-curie-001"}},
+	))
+
+	ctx, md := openai.WithResponseMetadata(context.Background())
+	if _, err := client.CreateCompletion(ctx, openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "Say this is a test"}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if md.Model != "text-curie-001" {
+		t.Errorf("Expected text-curie-001, got %v", md.Model)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("Expected 2 requests, got %v", n)
+	}
+}
+
+func TestFallbackOtherError(t *testing.T) {
+	t.Parallel()
+	server := openaitest.NewServer(nil)
+	defer server.Close()
+	tracker, err := openai.NewBudgetTracker(filepath.Join(t.TempDir(), "budgets.json"), openai.DefaultPricing,
+		openai.Budget{Name: "daily", Scope: openai.BudgetScopeGlobal, Period: openai.Daily, MaxCost: 0.0001})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	client := server.OpenAI(openai.WithBudgetTracker(tracker), openai.WithFallback(
+		openai.FallbackPolicy{Models: []string{"text-curie-001", "text-davinci-003", "text-babbage-001"}},
+	))
+	server.Fake.Fail(openai.OperationCreateCompletion, openaitest.APIError(http.StatusServiceUnavailable, "server_error", "overloaded"))
+
+	// The budget refuses text-davinci-003 after the 503 of text-curie-001,
+	// which must not make the client fall back on text-babbage-001.
+	_, err = client.CreateCompletion(context.Background(), openai.CompletionsRequest{Model: "text-curie-001", Prompt: "Say this is a test"})
+	if !errors.Is(err, openai.ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded, got %#v", err)
+	}
+	server.Fake.AssertCalled(t, openai.OperationCreateCompletion, 1)
+}
@@ -1,13 +1,5 @@
 module github.com/noclue/openai
 
-go 1.18
+go 1.21
 
-require (
-	github.com/spf13/cobra v1.6.1
-	gopkg.in/yaml.v2 v2.4.0
-)
-
-require (
-	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
-)
+require golang.org/x/sys v0.20.0
@@ -0,0 +1,197 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrContentBlocked is the error returned when a moderation guard blocks the
+// prompt or the generated text of a call.
+var ErrContentBlocked = errors.New("openai: content blocked")
+
+// ContentBlockedError describes the text a moderation guard blocked. It wraps
+// ErrContentBlocked.
+type ContentBlockedError struct {
+	// Operation is the operation of the blocked call, e.g.
+	// OperationCreateCompletion.
+	Operation string
+	// Stage is GuardInput if the request was blocked before it was sent, or
+	// GuardOutput if the generated text was blocked.
+	Stage GuardStage
+	// Field is the blocked field, e.g. "prompt" or "choices[0].text".
+	Field string
+	// Decision is the decision of the policy with the moderation result of
+	// the text.
+	Decision ModerationDecision
+}
+
+// Error returns the error message
+func (e *ContentBlockedError) Error() string {
+	var reasons []string
+	for _, r := range e.Decision.Reasons {
+		if r.Action == ActionBlock {
+			reasons = append(reasons, r.String())
+		}
+	}
+	return fmt.Sprintf("%v: %v %v %v: %v", ErrContentBlocked, e.Operation, e.Stage, e.Field, strings.Join(reasons, "; "))
+}
+
+// Unwrap returns ErrContentBlocked.
+func (e *ContentBlockedError) Unwrap() error {
+	return ErrContentBlocked
+}
+
+// GuardStage is the stage of a call at which a moderation guard moderates
+// text.
+type GuardStage string
+
+const (
+	// GuardInput moderates the prompts of requests before they are sent.
+	GuardInput GuardStage = "input"
+	// GuardOutput moderates the generated text of responses.
+	GuardOutput GuardStage = "output"
+)
+
+// GuardOptions configures a moderation guard.
+type GuardOptions struct {
+	// Stages are the stages at which text is moderated. The default is both
+	// GuardInput and GuardOutput.
+	Stages []GuardStage
+	// Model is the moderation model. The default is the API's default.
+	Model string
+	// OnWarn, if not nil, is called with the decisions that warn about a
+	// text. The call proceeds.
+	OnWarn func(ctx context.Context, operation string, stage GuardStage, field string, decision ModerationDecision)
+}
+
+// guardedText is a text of a call moderated by a guard.
+type guardedText struct {
+	field string
+	text  string
+}
+
+// moderationGuard moderates the prompts and generated text of calls.
+type moderationGuard struct {
+	engine  *ModerationEngine
+	options GuardOptions
+	input   bool
+	output  bool
+}
+
+// WithModerationGuard makes the client moderate the prompts of completions,
+// edits, images and image edits requests before sending them, and the text
+// generated by completions and edits, and decide on them with engine. A call
+// whose text the engine blocks fails with a *ContentBlockedError. A call whose
+// text cannot be moderated fails too, with an error wrapping the error of the
+// moderation call, so the guard fails closed. The text is moderated with the
+// client of the engine, or with the guarded client itself if the engine was
+// created with a nil client. Moderation calls are not guarded.
+func WithModerationGuard(engine *ModerationEngine, options GuardOptions) Option {
+	return func(o *openAI) {
+		g := &moderationGuard{engine: engine, options: options}
+		if len(options.Stages) == 0 {
+			g.input, g.output = true, true
+		}
+		for _, stage := range options.Stages {
+			switch stage {
+			case GuardInput:
+				g.input = true
+			case GuardOutput:
+				g.output = true
+			}
+		}
+		o.guard = g
+	}
+}
+
+// guarding moderates the texts of the calls passing through it.
+func (o *openAI) guarding(next Handler) Handler {
+	return func(ctx context.Context, call *Call) error {
+		g := o.guard
+		if g.input {
+			if err := o.checkTexts(ctx, call, GuardInput, guardedInputs(call)); err != nil {
+				return err
+			}
+		}
+		if err := next(ctx, call); err != nil {
+			return err
+		}
+		if g.output {
+			return o.checkTexts(ctx, call, GuardOutput, guardedOutputs(call))
+		}
+		return nil
+	}
+}
+
+// checkTexts moderates the non-empty texts of the call in one request and
+// returns a *ContentBlockedError for the first text the guard blocks.
+func (o *openAI) checkTexts(ctx context.Context, call *Call, stage GuardStage, texts []guardedText) error {
+	g := o.guard
+	req := ModerationRequest{Model: g.options.Model}
+	var fields []string
+	for _, t := range texts {
+		if t.text != "" {
+			req.Input = append(req.Input, t.text)
+			fields = append(fields, t.field)
+		}
+	}
+	if len(req.Input) == 0 {
+		return nil
+	}
+	var client OpenAI = o
+	if g.engine.client != nil {
+		client = g.engine.client
+	}
+	if call.IdempotencyKey != "" {
+		ctx = WithIdempotencyKey(ctx, derivedIdempotencyKey(call.IdempotencyKey, "moderation-"+string(stage)))
+	}
+	decisions, err := g.engine.moderate(ctx, client, req)
+	if err != nil {
+		return fmt.Errorf("openai: moderation guard error: %w", err)
+	}
+	for i, d := range decisions {
+		switch d.Action {
+		case ActionBlock:
+			return &ContentBlockedError{Operation: call.Operation, Stage: stage, Field: fields[i], Decision: d}
+		case ActionWarn:
+			if g.options.OnWarn != nil {
+				g.options.OnWarn(ctx, call.Operation, stage, fields[i], d)
+			}
+		}
+	}
+	return nil
+}
+
+// guardedInputs returns the prompts of the request of the call.
+func guardedInputs(call *Call) []guardedText {
+	switch req := call.Request.(type) {
+	case *CompletionsRequest:
+		return []guardedText{{"prompt", req.Prompt}}
+	case *EditRequest:
+		return []guardedText{{"input", req.Input}, {"instruction", req.Instruction}}
+	case *CreateImageReq:
+		return []guardedText{{"prompt", req.Prompt}}
+	case *CreateImageEditsReq:
+		return []guardedText{{"prompt", req.Prompt}}
+	default:
+		return nil
+	}
+}
+
+// guardedOutputs returns the generated text of the response of the call.
+func guardedOutputs(call *Call) []guardedText {
+	var res []guardedText
+	switch resp := call.Response.(type) {
+	case *CompletionsResponse:
+		for i, choice := range resp.Choices {
+			res = append(res, guardedText{fmt.Sprintf("choices[%d].text", i), choice.Text})
+		}
+	case *EditResponse:
+		for i, choice := range resp.Choices {
+			res = append(res, guardedText{fmt.Sprintf("choices[%d].text", i), choice.Text})
+		}
+	}
+	return res
+}
@@ -0,0 +1,130 @@
+package openai_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaitest"
+)
+
+// scoreModeration scores texts containing "bad" 0.9 and texts containing
+// "meh" 0.5 for violence.
+func scoreModeration(ctx context.Context, request any) (any, error) {
+	req := request.(openai.ModerationRequest)
+	resp := &openai.ModerationResponse{}
+	for _, input := range req.Input {
+		var result openai.ModerationResult
+		switch {
+		case strings.Contains(input, "bad"):
+			result.CategoryScores.Violence = 0.9
+		case strings.Contains(input, "meh"):
+			result.CategoryScores.Violence = 0.5
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
+
+func TestModerationGuard(t *testing.T) {
+	t.Parallel()
+	engine, err := openai.NewModerationEngine(nil, openai.ModerationPolicy{
+		Default: openai.CategoryThresholds{Warn: 0.4, Block: 0.8},
+	})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	var warnings []string
+	server := openaitest.NewServer(nil)
+	defer server.Close()
+	client := server.OpenAI(openai.WithModerationGuard(engine, openai.GuardOptions{
+		OnWarn: func(ctx context.Context, operation string, stage openai.GuardStage, field string, decision openai.ModerationDecision) {
+			warnings = append(warnings, operation+" "+string(stage)+" "+field)
+		},
+	}))
+	server.Fake.Handle(openai.OperationModeration, scoreModeration)
+	ctx := context.Background()
+
+	if _, err := client.CreateCompletion(ctx, openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "a meh prompt"}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if len(warnings) != 1 || warnings[0] != "CreateCompletion input prompt" {
+		t.Errorf("Expected prompt warning, got %v", warnings)
+	}
+	server.Fake.AssertCalled(t, openai.OperationModeration, 2)
+
+	_, err = client.CreateCompletion(ctx, openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "a bad prompt"})
+	var blocked *openai.ContentBlockedError
+	if !errors.As(err, &blocked) || !errors.Is(err, openai.ErrContentBlocked) {
+		t.Fatalf("Expected content blocked error, got %#v", err)
+	}
+	if blocked.Stage != openai.GuardInput || blocked.Field != "prompt" || blocked.Decision.Result.CategoryScores.Violence != 0.9 {
+		t.Errorf("Expected blocked prompt, got %#v", blocked)
+	}
+	server.Fake.AssertCalled(t, openai.OperationCreateCompletion, 1)
+
+	_, err = client.Edit(ctx, openai.EditRequest{Model: "text-davinci-edit-001", Input: "fine", Instruction: "make it bad"})
+	if !errors.As(err, &blocked) || blocked.Field != "instruction" {
+		t.Errorf("Expected blocked instruction, got %#v", err)
+	}
+	server.Fake.AssertNotCalled(t, openai.OperationEdit)
+
+	server.Fake.Respond(openai.OperationCreateCompletion, &openai.CompletionsResponse{Choices: []openai.Choice{{Text: "fine"}, {Text: "bad", Index: 1}}})
+	_, err = client.CreateCompletion(ctx, openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "fine"})
+	if !errors.As(err, &blocked) || blocked.Stage != openai.GuardOutput || blocked.Field != "choices[1].text" {
+		t.Errorf("Expected blocked output, got %#v", err)
+	}
+	if want := "openai: content blocked: CreateCompletion output choices[1].text: block: violence score 0.9000 reached threshold 0.8000"; err.Error() != want {
+		t.Errorf("Expected %q, got %q", want, err.Error())
+	}
+
+	if _, err := client.CreateImage(ctx, openai.CreateImageReq{Prompt: "a bad image"}); !errors.As(err, &blocked) {
+		t.Errorf("Expected blocked image prompt, got %#v", err)
+	}
+	server.Fake.AssertNotCalled(t, openai.OperationCreateImage)
+}
+
+func TestModerationGuardModerationError(t *testing.T) {
+	t.Parallel()
+	unavailable := openaitest.APIError(http.StatusServiceUnavailable, "server_error", "overloaded")
+	fake := openaitest.NewFake().Fail(openai.OperationModeration, unavailable)
+	engine, err := openai.NewModerationEngine(fake, openai.ModerationPolicy{Default: openai.CategoryThresholds{Block: 0.8}})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	server := openaitest.NewServer(nil)
+	defer server.Close()
+	client := server.OpenAI(openai.WithModerationGuard(engine, openai.GuardOptions{}))
+
+	_, err = client.CreateCompletion(context.Background(), openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "fine"})
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || errors.Is(err, openai.ErrContentBlocked) {
+		t.Errorf("Expected wrapped moderation error, got %#v", err)
+	}
+	server.Fake.AssertNotCalled(t, openai.OperationCreateCompletion)
+}
+
+func TestModerationGuardStages(t *testing.T) {
+	t.Parallel()
+	fake := openaitest.NewFake().Handle(openai.OperationModeration, scoreModeration)
+	engine, err := openai.NewModerationEngine(fake, openai.ModerationPolicy{Default: openai.CategoryThresholds{Block: 0.8}})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	server := openaitest.NewServer(nil)
+	defer server.Close()
+	client := server.OpenAI(openai.WithModerationGuard(engine, openai.GuardOptions{Stages: []openai.GuardStage{openai.GuardOutput}}))
+	server.Fake.Respond(openai.OperationCreateCompletion, &openai.CompletionsResponse{Choices: []openai.Choice{{Text: "fine"}}})
+
+	if _, err := client.CreateCompletion(context.Background(), openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "bad"}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	fake.AssertCalled(t, openai.OperationModeration, 1)
+	if req := fake.LastRequest(openai.OperationModeration).(openai.ModerationRequest); len(req.Input) != 1 || req.Input[0] != "fine" {
+		t.Errorf("Expected output moderation only, got %#v", req)
+	}
+	server.Fake.AssertNotCalled(t, openai.OperationModeration)
+}
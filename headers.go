@@ -0,0 +1,229 @@
+package openai
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+)
+
+// WithHeaders adds default headers to every request of the client, e.g. a
+// tenant ID required by a gateway. Headers set by the client, like
+// Authorization, take precedence.
+func WithHeaders(header http.Header) Option {
+	return func(o *openAI) {
+		if o.headers == nil {
+			o.headers = http.Header{}
+		}
+		for name, values := range header {
+			o.headers[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+}
+
+// WithProject sets the project to use for the requests to the OpenAI API in
+// the OpenAI-Project header.
+func WithProject(project string) Option {
+	return func(o *openAI) {
+		o.project = project
+	}
+}
+
+// requestOptions are the options of the requests made with a context.
+type requestOptions struct {
+	header         http.Header
+	organization   string
+	project        string
+	requestID      string
+	idempotencyKey string
+}
+
+type requestOptionsKey struct{}
+
+// requestOptionsFromContext returns the request options of the context.
+func requestOptionsFromContext(ctx context.Context) requestOptions {
+	opts, _ := ctx.Value(requestOptionsKey{}).(requestOptions)
+	return opts
+}
+
+// withRequestOptions returns a context with the request options of ctx
+// updated by update.
+func withRequestOptions(ctx context.Context, update func(*requestOptions)) context.Context {
+	opts := requestOptionsFromContext(ctx)
+	opts.header = opts.header.Clone()
+	update(&opts)
+	return context.WithValue(ctx, requestOptionsKey{}, opts)
+}
+
+// WithRequestHeaders returns a context that adds the headers to the requests
+// made with it, in addition to the default headers of the client and headers
+// added by parent contexts. Headers set by the client, like Authorization,
+// take precedence.
+func WithRequestHeaders(ctx context.Context, header http.Header) context.Context {
+	return withRequestOptions(ctx, func(opts *requestOptions) {
+		if opts.header == nil {
+			opts.header = http.Header{}
+		}
+		for name, values := range header {
+			opts.header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	})
+}
+
+// WithRequestOrganization returns a context that overrides the organization of
+// the requests made with it.
+func WithRequestOrganization(ctx context.Context, organization string) context.Context {
+	return withRequestOptions(ctx, func(opts *requestOptions) {
+		opts.organization = organization
+	})
+}
+
+// WithRequestProject returns a context that overrides the project of the
+// requests made with it.
+func WithRequestProject(ctx context.Context, project string) context.Context {
+	return withRequestOptions(ctx, func(opts *requestOptions) {
+		opts.project = project
+	})
+}
+
+// WithRequestID returns a context that sets the X-Request-ID of the requests
+// made with it instead of a generated one.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return withRequestOptions(ctx, func(opts *requestOptions) {
+		opts.requestID = id
+	})
+}
+
+// WithIdempotencyKey returns a context that sets the Idempotency-Key of the
+// calls made with it instead of a generated one. Requests a call sends in
+// addition to its own, like those of fallback models, hedges, moderation
+// guards or ModerateChunked batches, use keys derived from it.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return withRequestOptions(ctx, func(opts *requestOptions) {
+		opts.idempotencyKey = key
+	})
+}
+
+// accountScope returns a hash of the account and the options the requests
+// of the call made with ctx are sent with: the base URL, API key,
+// organization, project and headers of the client, and the organization,
+// project and headers of the context. Cached and coalesced responses are only
+// shared by calls of the same scope. The API key is left out with a key pool,
+// whose keys are chosen per request, so calls sharing a pool share a scope.
+// It returns an error if the API key cannot be provided.
+func (o *openAI) accountScope(ctx context.Context, call *Call) (string, error) {
+	opts := requestOptionsFromContext(ctx)
+	var apiKey string
+	if o.keyPool == nil {
+		var err error
+		if apiKey, err = o.callAPIKey(ctx, call); err != nil {
+			return "", err
+		}
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %q %q %q %q\n", o.baseURL, apiKey, o.organization, o.project, opts.organization, opts.project)
+	o.headers.Write(h)
+	h.Write([]byte("\n"))
+	opts.header.Write(h)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// idempotencyKey returns the Idempotency-Key of the POST requests of the
+// call. It is generated once per call, so it is reused when a request of the
+// call is retried.
+func idempotencyKey(call *Call) string {
+	if call != nil && call.IdempotencyKey != "" {
+		return call.IdempotencyKey
+	}
+	var b [16]byte
+	cryptorand.Read(b[:])
+	key := "openai-go-" + hex.EncodeToString(b[:])
+	if call != nil {
+		call.IdempotencyKey = key
+	}
+	return key
+}
+
+// takeIdempotencyKey sets the Idempotency-Key of the call to the one of the
+// context, if any, and returns a context without it, so that the calls the
+// call makes itself, like the moderation calls of a guard, do not reuse it.
+func takeIdempotencyKey(ctx context.Context, call *Call) context.Context {
+	opts := requestOptionsFromContext(ctx)
+	if opts.idempotencyKey == "" {
+		return ctx
+	}
+	if call.IdempotencyKey == "" {
+		call.IdempotencyKey = opts.idempotencyKey
+	}
+	return withRequestOptions(ctx, func(opts *requestOptions) {
+		opts.idempotencyKey = ""
+	})
+}
+
+// derivedIdempotencyKey returns the Idempotency-Key of a request derived
+// from the one of another request, so that the server tells them apart but
+// deduplicates retries of either. It returns an empty key, to be generated,
+// if key is empty.
+func derivedIdempotencyKey(key, suffix string) string {
+	if key == "" {
+		return ""
+	}
+	return key + "-" + suffix
+}
+
+// setRequestHeaders sets the default headers of the client, the headers of
+// the context, the X-Request-ID and the Idempotency-Key of the request.
+func (o *openAI) setRequestHeaders(httpReq *http.Request, opts requestOptions) {
+	for name, values := range o.headers {
+		httpReq.Header[name] = append([]string(nil), values...)
+	}
+	for name, values := range opts.header {
+		httpReq.Header[name] = append([]string(nil), values...)
+	}
+	httpReq.Header.Set("User-Agent", userAgent)
+	httpReq.Header.Set("Accept", "application/json")
+	requestID := opts.requestID
+	if requestID == "" {
+		requestID = "openai-go-" + strconv.FormatUint(rand.Uint64(), 16)
+	}
+	httpReq.Header.Set("X-Request-ID", requestID)
+	if httpReq.Method == http.MethodPost {
+		httpReq.Header.Set("Idempotency-Key", idempotencyKey(callFromContext(httpReq.Context())))
+	}
+}
+
+// setAccountHeaders sets the organization and project headers of the request
+// from the context options, the key of a pool and the client in that order of
+// precedence.
+func (o *openAI) setAccountHeaders(httpReq *http.Request, opts requestOptions, key *poolKey) {
+	organization, project := o.organization, o.project
+	if key != nil {
+		if key.Organization != "" {
+			organization = key.Organization
+		}
+		if key.Project != "" {
+			project = key.Project
+		}
+	}
+	if opts.organization != "" {
+		organization = opts.organization
+	}
+	if opts.project != "" {
+		project = opts.project
+	}
+	setOrDelete(httpReq.Header, "OpenAI-Organization", organization)
+	setOrDelete(httpReq.Header, "OpenAI-Project", project)
+}
+
+// setOrDelete sets the header to value, or deletes it if value is empty.
+func setOrDelete(header http.Header, name, value string) {
+	if value != "" {
+		header.Set(name, value)
+	} else {
+		header.Del(name)
+	}
+}
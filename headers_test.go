@@ -0,0 +1,171 @@
+package openai_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/noclue/openai"
+)
+
+func TestHeaders(t *testing.T) {
+	t.Parallel()
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer server.Close()
+	client := openai.NewOpenAI(apiKey,
+		openai.WithBaseURL(server.URL),
+		openai.WithOrganization("org-default"),
+		openai.WithProject("proj-default"),
+		openai.WithHeaders(http.Header{"x-tenant-id": {"tenant-1"}, "Authorization": {"Bearer sk-gateway"}}),
+	)
+
+	if _, err := client.Models(context.Background()); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	ctx := openai.WithRequestHeaders(context.Background(), http.Header{"X-Tenant-ID": {"tenant-2"}})
+	ctx = openai.WithRequestHeaders(ctx, http.Header{"X-Trace": {"trace-1"}})
+	ctx = openai.WithRequestOrganization(ctx, "org-request")
+	ctx = openai.WithRequestProject(ctx, "proj-request")
+	ctx = openai.WithRequestID(ctx, "req-123")
+	if _, err := client.Models(ctx); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+
+	first, second := headers[0], headers[1]
+	if first.Get("X-Tenant-ID") != "tenant-1" || first.Get("OpenAI-Organization") != "org-default" || first.Get("OpenAI-Project") != "proj-default" {
+		t.Errorf("Expected default headers, got %v", first)
+	}
+	if !strings.HasPrefix(first.Get("X-Request-ID"), "openai-go-") {
+		t.Errorf("Expected generated request ID, got %v", first.Get("X-Request-ID"))
+	}
+	if first.Get("Authorization") != "Bearer "+apiKey {
+		t.Errorf("Expected client Authorization, got %v", first.Get("Authorization"))
+	}
+	if second.Get("X-Tenant-ID") != "tenant-2" || second.Get("X-Trace") != "trace-1" {
+		t.Errorf("Expected request headers, got %v", second)
+	}
+	if second.Get("OpenAI-Organization") != "org-request" || second.Get("OpenAI-Project") != "proj-request" || second.Get("X-Request-ID") != "req-123" {
+		t.Errorf("Expected overridden organization, project and request ID, got %v", second)
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	t.Parallel()
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-ID", "server-id")
+		if r.Header.Get("Authorization") == "Bearer sk-limited" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error": {"message": "Rate limit reached", "type": "requests"}}`))
+			return
+		}
+		w.Write([]byte(editsSuccessResponse))
+	}))
+	defer server.Close()
+	pool := openai.NewKeyPool(openai.RoundRobin, 0, openai.PoolKey{APIKey: "sk-limited"}, openai.PoolKey{APIKey: "sk-good"})
+	client := openai.NewOpenAI(apiKey, openai.WithBaseURL(server.URL), openai.WithKeyPool(pool))
+
+	ctx, md := openai.WithResponseMetadata(context.Background())
+	if _, err := client.Edit(ctx, openai.EditRequest{Input: "a"}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if len(headers) != 2 {
+		t.Fatalf("Expected a retry with another key, got %d requests", len(headers))
+	}
+	key := headers[0].Get("Idempotency-Key")
+	if key == "" || headers[1].Get("Idempotency-Key") != key || headers[1].Get("X-Request-ID") != headers[0].Get("X-Request-ID") {
+		t.Errorf("Expected retry with the same request ID and idempotency key, got %v and %v", headers[0], headers[1])
+	}
+	if md.IdempotencyKey != key || md.RequestID != headers[1].Get("X-Request-ID") || md.ServerRequestID != "server-id" {
+		t.Errorf("Expected request IDs in metadata, got %#v", md)
+	}
+
+	ctx = openai.WithIdempotencyKey(openai.WithRequestID(context.Background(), "my-request"), "my-key")
+	ctx, md = openai.WithResponseMetadata(ctx)
+	if _, err := client.Edit(ctx, openai.EditRequest{Input: "a"}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	last := headers[len(headers)-1]
+	if last.Get("Idempotency-Key") != "my-key" || last.Get("X-Request-ID") != "my-request" || md.RequestID != "my-request" || md.IdempotencyKey != "my-key" {
+		t.Errorf("Expected caller IDs, got %v, %#v", last, md)
+	}
+
+	if _, err := client.Edit(context.Background(), openai.EditRequest{Input: "a"}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if next := headers[len(headers)-1].Get("Idempotency-Key"); next == "" || next == key {
+		t.Errorf("Expected a new idempotency key for a new call, got %q", next)
+	}
+	if _, err := client.Models(context.Background()); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if got := headers[len(headers)-1].Get("Idempotency-Key"); got != "" {
+		t.Errorf("Expected no idempotency key for GET requests, got %q", got)
+	}
+}
+
+func TestDerivedIdempotencyKeys(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	keys := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		keys[r.URL.Path+" "+body.Model+" "+strings.Join(body.Input, ",")] = r.Header.Get("Idempotency-Key")
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/v1/moderations":
+			w.Write([]byte(`{"results": [` + strings.TrimSuffix(strings.Repeat(`{"flagged": false},`, len(body.Input)), ",") + `]}`))
+		case body.Model == "text-davinci-003":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error": {"message": "overloaded", "type": "server_error"}}`))
+		default:
+			w.Write([]byte(completionsSuccessResponse))
+		}
+	}))
+	defer server.Close()
+	engine, err := openai.NewModerationEngine(nil, openai.ModerationPolicy{})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	client := openai.NewOpenAI(apiKey, openai.WithBaseURL(server.URL),
+		openai.WithFallback(openai.FallbackPolicy{Models: []string{"text-davinci-003", "text-curie-001"}}),
+		openai.WithModerationGuard(engine, openai.GuardOptions{Stages: []openai.GuardStage{openai.GuardInput}}))
+
+	ctx := openai.WithIdempotencyKey(context.Background(), "my-key")
+	if _, err := client.CreateCompletion(ctx, openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "p"}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if _, err := openai.ModerateChunked(ctx, client, openai.ModerationRequest{Input: []string{"a", "b"}}, openai.ChunkOptions{BatchSize: 1}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	want := map[string]string{
+		"/v1/moderations  p":                "my-key-moderation-input",
+		"/v1/completions text-davinci-003 ": "my-key",
+		"/v1/completions text-curie-001 ":   "my-key-text-curie-001",
+		"/v1/moderations  a":                "my-key-batch-0",
+		"/v1/moderations  b":                "my-key-batch-1",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, keys)
+	}
+}
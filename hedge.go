@@ -0,0 +1,266 @@
+package openai
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults of HedgePolicy.
+const (
+	defaultHedgePercentile = 0.95
+	defaultHedgeWindow     = 100
+	minHedgeSamples        = 10
+)
+
+// HedgePolicy configures the hedging of slow calls.
+type HedgePolicy struct {
+	// Operations are the hedged operations. They default to
+	// OperationCreateCompletion and OperationEdit.
+	Operations []string
+	// Percentile is the percentile of the latencies of recent successful
+	// calls of an operation after which a hedge is sent, e.g. 0.95. It
+	// defaults to 0.95.
+	Percentile float64
+	// Delay is the time after which a hedge is sent until enough latencies
+	// of the operation were observed, and the minimum time after which a
+	// hedge is sent. If it is zero, calls are not hedged until enough
+	// latencies were observed.
+	Delay time.Duration
+	// MaxRatio caps the extra spend: at most this share of the calls is
+	// hedged, e.g. 0.1 for 10%. Zero means no cap.
+	MaxRatio float64
+	// Window is the number of recent latencies per operation the percentile
+	// is computed from. It defaults to 100.
+	Window int
+}
+
+// HedgeStats are statistics of a Hedger.
+type HedgeStats struct {
+	// Calls is the number of hedgeable calls.
+	Calls int64 `json:"calls"`
+	// Hedges is the number of hedges sent.
+	Hedges int64 `json:"hedges"`
+	// Wins is the number of calls answered by their hedge.
+	Wins int64 `json:"wins"`
+	// Capped is the number of hedges not sent because of the MaxRatio cap.
+	Capped int64 `json:"capped"`
+}
+
+// Hedger sends a duplicate request, the hedge, for calls that take longer
+// than most calls of their operation. The call is answered by whichever
+// request succeeds first and the other request is canceled. Both requests
+// pass through logging, budgets and usage accounting. It is safe for
+// concurrent use and can be shared by clients.
+type Hedger struct {
+	policy     HedgePolicy
+	operations map[string]bool
+
+	mu        sync.Mutex
+	latencies map[string]*latencyWindow
+	stats     HedgeStats
+}
+
+// NewHedger creates a hedger with the policy.
+func NewHedger(policy HedgePolicy) *Hedger {
+	if len(policy.Operations) == 0 {
+		policy.Operations = []string{OperationCreateCompletion, OperationEdit}
+	}
+	if policy.Percentile <= 0 || policy.Percentile > 1 {
+		policy.Percentile = defaultHedgePercentile
+	}
+	if policy.Window <= 0 {
+		policy.Window = defaultHedgeWindow
+	}
+	h := &Hedger{
+		policy:     policy,
+		operations: make(map[string]bool),
+		latencies:  make(map[string]*latencyWindow),
+	}
+	for _, op := range policy.Operations {
+		h.operations[op] = true
+	}
+	return h
+}
+
+// WithHedging makes the client hedge slow calls with the hedger. Calls
+// answered by their hedge have Call.Hedged and ResponseMetadata.Hedged set.
+func WithHedging(hedger *Hedger) Option {
+	return func(o *openAI) {
+		o.hedger = hedger
+	}
+}
+
+// Stats returns the statistics of the hedger.
+func (h *Hedger) Stats() HedgeStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stats
+}
+
+// latencyWindow holds the recent latencies of an operation.
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+// delay returns the time after which a call of the operation is hedged and
+// whether it is hedged at all.
+func (h *Hedger) delay(operation string) (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w := h.latencies[operation]
+	if w == nil || len(w.samples) < minHedgeSamples {
+		return h.policy.Delay, h.policy.Delay > 0
+	}
+	sorted := append([]time.Duration(nil), w.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	d := sorted[int(h.policy.Percentile*float64(len(sorted)-1))]
+	return max(d, h.policy.Delay), true
+}
+
+// observe records the latency of a successful request of the operation.
+func (h *Hedger) observe(operation string, latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w := h.latencies[operation]
+	if w == nil {
+		w = &latencyWindow{}
+		h.latencies[operation] = w
+	}
+	if len(w.samples) < h.policy.Window {
+		w.samples = append(w.samples, latency)
+		return
+	}
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % h.policy.Window
+}
+
+// allowHedge reports whether a hedge may be sent under the MaxRatio cap and
+// counts it.
+func (h *Hedger) allowHedge() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.policy.MaxRatio > 0 && float64(h.stats.Hedges+1) > h.policy.MaxRatio*float64(h.stats.Calls) {
+		h.stats.Capped++
+		return false
+	}
+	h.stats.Hedges++
+	return true
+}
+
+// hedgeAttempt is a request of a hedged call.
+type hedgeAttempt struct {
+	call   *Call
+	cancel context.CancelFunc
+	hedge  bool
+	err    error
+}
+
+// hedging hedges the calls of the hedger's operations.
+func (o *openAI) hedging(next Handler) Handler {
+	h := o.hedger
+	return func(ctx context.Context, call *Call) error {
+		if !h.operations[call.Operation] {
+			return next(ctx, call)
+		}
+		h.mu.Lock()
+		h.stats.Calls++
+		h.mu.Unlock()
+		delay, ok := h.delay(call.Operation)
+		if !ok {
+			start := time.Now()
+			err := next(ctx, call)
+			if err == nil {
+				h.observe(call.Operation, time.Since(start))
+			}
+			return err
+		}
+
+		// The primary request is sent with the Idempotency-Key of the call
+		// and the hedge with one derived from it, so that the server does not
+		// answer the hedge with the response of the slow request. Without a
+		// key, each request generates its own.
+		key := call.IdempotencyKey
+		results := make(chan *hedgeAttempt, 2)
+		start := func(hedge bool) *hedgeAttempt {
+			attemptCtx, cancel := context.WithCancel(ctx)
+			a := &hedgeAttempt{
+				call: &Call{
+					Operation:      call.Operation,
+					Request:        call.Request,
+					Response:       reflect.New(reflect.TypeOf(call.Response).Elem()).Interface(),
+					IdempotencyKey: key,
+					apiKey:         call.apiKey,
+				},
+				cancel: cancel,
+				hedge:  hedge,
+			}
+			if hedge {
+				a.call.IdempotencyKey = derivedIdempotencyKey(key, "hedge")
+			}
+			go func() {
+				begin := time.Now()
+				a.err = next(attemptCtx, a.call)
+				if a.err == nil {
+					h.observe(call.Operation, time.Since(begin))
+				}
+				results <- a
+			}()
+			return a
+		}
+
+		primary := start(false)
+		attempts := []*hedgeAttempt{primary}
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		var first *hedgeAttempt
+		select {
+		case first = <-results:
+		case <-timer.C:
+			if h.allowHedge() {
+				attempts = append(attempts, start(true))
+			}
+			first = <-results
+		}
+		winner, done := first, []*hedgeAttempt{first}
+		if first.err != nil && len(attempts) == 2 {
+			second := <-results
+			done = append(done, second)
+			if second.err == nil || !second.hedge {
+				winner = second
+			}
+		}
+		for _, a := range attempts {
+			a.cancel()
+		}
+
+		if winner.hedge && winner.err == nil {
+			h.mu.Lock()
+			h.stats.Wins++
+			h.mu.Unlock()
+		}
+		call.Hedged = winner.hedge
+		call.Method = winner.call.Method
+		call.Endpoint = winner.call.Endpoint
+		call.StatusCode = winner.call.StatusCode
+		call.Header = winner.call.Header
+		call.RequestID = winner.call.RequestID
+		if key == "" {
+			call.IdempotencyKey = winner.call.IdempotencyKey
+		}
+		// The attempts of a canceled request still in flight are unknown;
+		// it sent at least one.
+		call.Attempts += len(attempts) - len(done)
+		for _, a := range done {
+			call.Attempts += a.call.Attempts
+		}
+		if winner.err != nil {
+			return winner.err
+		}
+		reflect.ValueOf(call.Response).Elem().Set(reflect.ValueOf(winner.call.Response).Elem())
+		return nil
+	}
+}
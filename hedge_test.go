@@ -0,0 +1,169 @@
+package openai_test
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaitest"
+)
+
+// slowFirst returns a handler whose first call blocks until it is canceled,
+// which is reported on canceled.
+func slowFirst(canceled chan<- struct{}) openaitest.HandlerFunc {
+	var calls atomic.Int32
+	return func(ctx context.Context, request any) (any, error) {
+		if calls.Add(1) == 1 {
+			<-ctx.Done()
+			close(canceled)
+			return nil, ctx.Err()
+		}
+		return openaitest.DefaultResponse(openai.OperationCreateCompletion, request)
+	}
+}
+
+func TestHedging(t *testing.T) {
+	t.Parallel()
+	canceled := make(chan struct{})
+	server := openaitest.NewServer(openaitest.NewFake().Handle(openai.OperationCreateCompletion, slowFirst(canceled)))
+	defer server.Close()
+	hedger := openai.NewHedger(openai.HedgePolicy{Delay: 20 * time.Millisecond})
+	client := server.OpenAI(openai.WithHedging(hedger))
+
+	ctx, md := openai.WithResponseMetadata(context.Background())
+	res, err := client.CreateCompletion(ctx, openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "Say this is a test"})
+	if err != nil || res.Choices[0].Text != openaitest.CompletionText {
+		t.Fatalf("Expected completion, got %#v, %#v", res, err)
+	}
+	if !md.Hedged {
+		t.Error("Expected hedged response")
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("Expected slow request to be canceled")
+	}
+	if stats := hedger.Stats(); stats != (openai.HedgeStats{Calls: 1, Hedges: 1, Wins: 1}) {
+		t.Errorf("Expected 1 winning hedge, got %#v", stats)
+	}
+
+	ctx, md = openai.WithResponseMetadata(context.Background())
+	if _, err := client.Edit(ctx, openai.EditRequest{Input: "fast"}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if md.Hedged || hedger.Stats().Hedges != 1 {
+		t.Errorf("Expected fast call without hedge, got %#v", hedger.Stats())
+	}
+}
+
+// headerRecorder records the headers of the requests it sends with client.
+type headerRecorder struct {
+	client  openai.HttpClient
+	mu      sync.Mutex
+	headers []http.Header
+}
+
+func (r *headerRecorder) Do(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	r.headers = append(r.headers, req.Header.Clone())
+	r.mu.Unlock()
+	return r.client.Do(req)
+}
+
+// sent returns the headers of the request sent with the Idempotency-Key.
+func (r *headerRecorder) sent(key string) (http.Header, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, h := range r.headers {
+		if h.Get("Idempotency-Key") == key {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+// TestHedgingCallState tests the per-call state of a call answered by its
+// hedge: the Idempotency-Key set by the caller, the X-Request-ID of the
+// winning request and the budget reservations of both requests.
+func TestHedgingCallState(t *testing.T) {
+	t.Parallel()
+	canceled := make(chan struct{})
+	server := openaitest.NewServer(openaitest.NewFake().Handle(openai.OperationCreateCompletion, slowFirst(canceled)))
+	defer server.Close()
+	tracker, err := openai.NewBudgetTracker(filepath.Join(t.TempDir(), "budgets.json"), openai.DefaultPricing,
+		openai.Budget{Name: "tokens", Scope: openai.BudgetScopeGlobal, Period: openai.Daily, MaxTokens: 1000})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	recorder := &headerRecorder{client: server.Client()}
+	hedger := openai.NewHedger(openai.HedgePolicy{Delay: 20 * time.Millisecond})
+	client := server.OpenAI(openai.WithHttpClient(recorder), openai.WithHedging(hedger), openai.WithBudgetTracker(tracker))
+
+	ctx, md := openai.WithResponseMetadata(context.Background())
+	ctx = openai.WithIdempotencyKey(ctx, "my-key")
+	res, err := client.CreateCompletion(ctx, openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "Say this is a test"})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if !md.Hedged {
+		t.Fatal("Expected hedged response")
+	}
+	if md.IdempotencyKey != "my-key" {
+		t.Errorf("Expected the caller's Idempotency-Key, got %q", md.IdempotencyKey)
+	}
+	if _, ok := recorder.sent("my-key"); !ok {
+		t.Error("Expected the slow request to be sent with the caller's Idempotency-Key")
+	}
+	hedge, ok := recorder.sent("my-key-hedge")
+	if !ok {
+		t.Fatal("Expected the hedge to be sent with a derived Idempotency-Key")
+	}
+	if id := hedge.Get("X-Request-ID"); id == "" || md.RequestID != id {
+		t.Errorf("Expected the X-Request-ID of the hedge %q, got %q", id, md.RequestID)
+	}
+
+	// Only the hedge is charged, and the reservation of the canceled request
+	// is released once it returns.
+	<-canceled
+	used := int64(res.Usage.TotalTokens)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		reservation, err := tracker.Check("", openai.UsageRecord{Usage: openai.Usage{TotalTokens: int(1000 - used)}})
+		if err == nil {
+			reservation.Release()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the reservations of both requests to be settled, got %#v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := tracker.Status(); len(status) != 1 || status[0].Tokens != used {
+		t.Errorf("Expected %d tokens charged once, got %#v", used, status)
+	}
+}
+
+func TestHedgingMaxRatio(t *testing.T) {
+	t.Parallel()
+	canceled := make(chan struct{})
+	fake := openaitest.NewFake().Handle(openai.OperationCreateCompletion, slowFirst(canceled))
+	server := openaitest.NewServer(fake)
+	defer server.Close()
+	hedger := openai.NewHedger(openai.HedgePolicy{Delay: 20 * time.Millisecond, MaxRatio: 0.5})
+	client := server.OpenAI(openai.WithHedging(hedger))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := client.CreateCompletion(ctx, openai.CompletionsRequest{Prompt: "slow"}); err == nil {
+		t.Error("Expected timeout without hedge, got nil")
+	}
+	if stats := hedger.Stats(); stats != (openai.HedgeStats{Calls: 1, Capped: 1}) {
+		t.Errorf("Expected capped hedge, got %#v", stats)
+	}
+	fake.AssertCalled(t, openai.OperationCreateCompletion, 1)
+}
@@ -6,22 +6,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"math/rand"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
 )
 
-func (o *openAI) makeJSONRequest(ctx context.Context, uri string, req any, resp any) error {
+// makeJSONRequest makes a JSON request to the path of the OpenAI API.
+func (o *openAI) makeJSONRequest(ctx context.Context, path string, req any, resp any) error {
 	bodyBytes, err := json.Marshal(req)
 	if err != nil {
 		return fmt.Errorf("openai: JSON encoding error: %w", err)
 	}
+	reqURL, err := o.requestURL(ctx, path)
+	if err != nil {
+		return err
+	}
 	body := bytes.NewBuffer(bodyBytes)
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", uri, body)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", reqURL, body)
 	if err != nil {
 		return fmt.Errorf("openai: HTTP request creation error: %w", err)
 	}
@@ -30,9 +33,13 @@ func (o *openAI) makeJSONRequest(ctx context.Context, uri string, req any, resp
 	return o.makeHttpRequest(httpReq, resp)
 }
 
-// makeMultiPartRequest makes a multipart request to the OpenAI API. It accepts a
-// map of form fields and a list of files paths to upload.
-func (o *openAI) makeMultiPartRequest(ctx context.Context, uri string, fields map[string]string, files map[string]string, resp any) error {
+// makeMultiPartRequest makes a multipart request to the path of the OpenAI API.
+// It accepts a map of form fields and a list of files paths to upload.
+func (o *openAI) makeMultiPartRequest(ctx context.Context, path string, fields map[string]string, files map[string]string, resp any) error {
+	reqURL, err := o.requestURL(ctx, path)
+	if err != nil {
+		return err
+	}
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 	for key, val := range fields {
@@ -57,7 +64,7 @@ func (o *openAI) makeMultiPartRequest(ctx context.Context, uri string, fields ma
 	if err := writer.Close(); err != nil {
 		return fmt.Errorf("openai: multipart form closing error: %w", err)
 	}
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", uri, body)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", reqURL, body)
 	if err != nil {
 		return fmt.Errorf("openai: HTTP request creation error: %w", err)
 	}
@@ -66,24 +73,91 @@ func (o *openAI) makeMultiPartRequest(ctx context.Context, uri string, fields ma
 }
 
 func (o *openAI) makeHttpRequest(httpReq *http.Request, resp any) error {
-	httpReq.Header.Set("Authorization", "Bearer "+o.APIKey)
-	httpReq.Header.Set("User-Agent", userAgent)
-	httpReq.Header.Set("Accept", "application/json")
-	httpReq.Header.Set("X-Request-ID", "openai-go-"+strconv.FormatUint(rand.Uint64(), 16))
-	if o.organization != "" {
-		httpReq.Header.Set("OpenAI-Organization", o.organization)
-	}
-	httpResp, err := o.Client.Do(httpReq)
-	if err != nil {
-		return fmt.Errorf("openai: HTTP error: %w", err)
+	opts := requestOptionsFromContext(httpReq.Context())
+	o.setRequestHeaders(httpReq, opts)
+	call := callFromContext(httpReq.Context())
+	endpoint := httpReq.URL.Path
+	if err := o.breaker.allow(endpoint); err != nil {
+		return err
+	}
+	sent, status := false, 0
+	defer func() {
+		// Requests refused before they are sent are not counted.
+		outcome := requestCanceled
+		if sent {
+			outcome = requestOutcomeOf(status, httpReq.Context().Err())
+		}
+		o.breaker.done(endpoint, outcome)
+	}()
+	var httpResp *http.Response
+	var err error
+	for tries := 1; ; tries++ {
+		key := o.keyPool.acquire()
+		var apiKey string
+		if key != nil {
+			apiKey = key.APIKey
+		} else if apiKey, err = o.callAPIKey(httpReq.Context(), call); err != nil {
+			return err
+		}
+		if err := o.reserveBudget(call, apiKey); err != nil {
+			if key != nil {
+				o.keyPool.release(key, 0, nil)
+			}
+			return err
+		}
+		if o.azure != nil {
+			httpReq.Header.Set("api-key", apiKey)
+		} else {
+			httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		o.setAccountHeaders(httpReq, opts, key)
+		if call != nil {
+			call.Attempts++
+			call.RequestID = httpReq.Header.Get("X-Request-ID")
+			call.Method = httpReq.Method
+			call.Endpoint = httpReq.URL.Path
+		}
+		o.logRequest(httpReq)
+		sent = true
+		httpResp, err = o.Client.Do(httpReq)
+		if key != nil {
+			if err != nil {
+				o.keyPool.release(key, 0, nil)
+			} else {
+				o.keyPool.release(key, httpResp.StatusCode, httpResp.Header)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("openai: HTTP error: %w", err)
+		}
+		status = httpResp.StatusCode
+		if call != nil {
+			call.StatusCode = httpResp.StatusCode
+			call.Header = httpResp.Header
+		}
+		if err = o.logResponse(httpReq.Context(), httpResp); err != nil {
+			return err
+		}
+		// Retry requests failing with a benched key with another key.
+		if key == nil || !benchStatus(httpResp.StatusCode) || tries >= o.keyPool.size() ||
+			!o.keyPool.available() || (httpReq.Body != nil && httpReq.GetBody == nil) {
+			break
+		}
+		io.Copy(io.Discard, httpResp.Body)
+		httpResp.Body.Close()
+		if httpReq.GetBody != nil {
+			if httpReq.Body, err = httpReq.GetBody(); err != nil {
+				return fmt.Errorf("openai: HTTP request body error: %w", err)
+			}
+		}
 	}
 
-	if err = checkErrResponse(httpResp); err != nil {
+	if err := checkErrResponse(httpResp); err != nil {
 		return err
 	}
 	defer httpResp.Body.Close()
 
-	if err = checkJSONContentType(httpResp); err != nil {
+	if err := checkJSONContentType(httpResp); err != nil {
 		return err
 	}
 	responseBody, err := io.ReadAll(httpResp.Body)
@@ -6,9 +6,9 @@ import (
 	"strconv"
 )
 
-var imagesPath = fmt.Sprintf("%v/%v/images", basePath, apiVersion)
+var imagesPath = fmt.Sprintf("/%v/images", apiVersion)
 
-var createImagePath = imagesPath + "/generations" //"https://api.openai.com/v1/images/generations"
+var createImagePath = imagesPath + "/generations"
 var imageVariationsPath = imagesPath + "/variations"
 var createImageEditsPath = imagesPath + "/edits"
 
@@ -51,6 +51,39 @@ type CommonImageReq struct {
 	User string `json:"user,omitempty"`
 }
 
+// formFields returns the multipart form fields of the request parameters.
+func (r CommonImageReq) formFields() map[string]string {
+	params := map[string]string{}
+	if r.N != nil {
+		params["n"] = strconv.Itoa(*r.N)
+	}
+	if r.Size != "" {
+		params["size"] = string(r.Size)
+	}
+	if r.ResponseFormat != "" {
+		params["response_format"] = string(r.ResponseFormat)
+	}
+	if r.User != "" {
+		params["user"] = r.User
+	}
+	return params
+}
+
+// imageRequest returns the common parameters of the request of an images
+// call.
+func imageRequest(call *Call) CommonImageReq {
+	switch req := call.Request.(type) {
+	case *CreateImageReq:
+		return req.CommonImageReq
+	case *CreateImageVariationsReq:
+		return req.CommonImageReq
+	case *CreateImageEditsReq:
+		return req.CommonImageReq
+	default:
+		return CommonImageReq{}
+	}
+}
+
 // ImageData is the image data. If ResponseFormat is url, this is the
 // url to the image. If ResponseFormat is b64_json, this is the base64 encoded
 // image data.
@@ -85,12 +118,14 @@ type CreateImageReq struct {
 // CreateImage makes a request to the OpenAI API to generate an image from a
 // text prompt.
 func (o *openAI) CreateImage(ctx context.Context, req CreateImageReq) (*ImageResponse, error) {
-	resp := &ImageResponse{}
-	err := o.makeJSONRequest(ctx, createImagePath, req, resp)
+	call := &Call{Operation: OperationCreateImage, Request: &req, Response: &ImageResponse{}}
+	err := o.invoke(ctx, call, func(ctx context.Context, call *Call) error {
+		return o.makeJSONRequest(ctx, createImagePath, call.Request, call.Response)
+	})
 	if err != nil {
 		return nil, err
 	}
-	return resp, nil
+	return call.Response.(*ImageResponse), nil
 }
 
 // CreateImageVariationReq is the request body for the OpenAI API to generate
@@ -106,25 +141,16 @@ type CreateImageVariationsReq struct {
 // CreateImageVariations makes a request to the OpenAI API to generate image
 // variations.
 func (o *openAI) CreateImageVariations(ctx context.Context, req CreateImageVariationsReq) (*ImageResponse, error) {
-	resp := &ImageResponse{}
-	params := map[string]string{}
-	if req.N != nil {
-		params["n"] = strconv.Itoa(*req.N)
-	}
-	if req.Size != "" {
-		params["size"] = string(req.Size)
-	}
-	if req.ResponseFormat != "" {
-		params["response_format"] = string(req.ResponseFormat)
-	}
-	if req.User != "" {
-		params["user"] = req.User
-	}
-	err := o.makeMultiPartRequest(ctx, imageVariationsPath, params, map[string]string{"image": req.Image}, resp)
+	call := &Call{Operation: OperationCreateImageVariations, Request: &req, Response: &ImageResponse{}}
+	err := o.invoke(ctx, call, func(ctx context.Context, call *Call) error {
+		req := call.Request.(*CreateImageVariationsReq)
+		params := req.CommonImageReq.formFields()
+		return o.makeMultiPartRequest(ctx, imageVariationsPath, params, map[string]string{"image": req.Image}, call.Response)
+	})
 	if err != nil {
 		return nil, err
 	}
-	return resp, nil
+	return call.Response.(*ImageResponse), nil
 }
 
 // CreateImageEditsReq contains the request paramters for the OpenAI API to
@@ -147,28 +173,19 @@ type CreateImageEditsReq struct {
 // CreateImageEdits creates an edited or extended image given an original image
 // and a prompt.
 func (o *openAI) CreateImageEdits(ctx context.Context, req CreateImageEditsReq) (*ImageResponse, error) {
-	resp := &ImageResponse{}
-	params := map[string]string{}
-	params["prompt"] = req.Prompt
-	if req.N != nil {
-		params["n"] = strconv.Itoa(*req.N)
-	}
-	if req.Size != "" {
-		params["size"] = string(req.Size)
-	}
-	if req.ResponseFormat != "" {
-		params["response_format"] = string(req.ResponseFormat)
-	}
-	if req.User != "" {
-		params["user"] = req.User
-	}
-	files := map[string]string{"image": req.Image}
-	if req.Mask != "" {
-		files["mask"] = req.Mask
-	}
-	err := o.makeMultiPartRequest(ctx, createImageEditsPath, params, files, resp)
+	call := &Call{Operation: OperationCreateImageEdits, Request: &req, Response: &ImageResponse{}}
+	err := o.invoke(ctx, call, func(ctx context.Context, call *Call) error {
+		req := call.Request.(*CreateImageEditsReq)
+		params := req.CommonImageReq.formFields()
+		params["prompt"] = req.Prompt
+		files := map[string]string{"image": req.Image}
+		if req.Mask != "" {
+			files["mask"] = req.Mask
+		}
+		return o.makeMultiPartRequest(ctx, createImageEditsPath, params, files, call.Response)
+	})
 	if err != nil {
 		return nil, err
 	}
-	return resp, nil
+	return call.Response.(*ImageResponse), nil
 }
@@ -115,4 +115,7 @@ func TestCreateImageError(t *testing.T) {
 	if openAIError.Code != "invalid_api_key" {
 		t.Errorf("Expected error code invalid_api_key, got %#v", openAIError)
 	}
+	if openAIError.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code 400, got %d", openAIError.StatusCode)
+	}
 }
@@ -0,0 +1,206 @@
+package openai
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultBenchDuration is the time keys are benched for by default.
+const defaultBenchDuration = time.Minute
+
+// KeySelection is how a KeyPool selects the key of a request.
+type KeySelection int
+
+const (
+	// RoundRobin selects the healthy keys in turn.
+	RoundRobin KeySelection = iota
+	// LeastLoaded selects the healthy key with the fewest requests in flight.
+	LeastLoaded
+)
+
+// PoolKey is an API key of a KeyPool.
+type PoolKey struct {
+	// Name identifies the key in health reports. It defaults to the
+	// fingerprint of the key.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// APIKey is the OpenAI API key.
+	APIKey string `json:"api_key" yaml:"api_key"`
+	// Organization is the organization of requests made with the key. It
+	// defaults to the organization of the client.
+	Organization string `json:"organization,omitempty" yaml:"organization,omitempty"`
+	// Project is the project of requests made with the key. It defaults to
+	// the project of the client.
+	Project string `json:"project,omitempty" yaml:"project,omitempty"`
+}
+
+// KeyHealth is the health of a key of a KeyPool.
+type KeyHealth struct {
+	Name string `json:"name"`
+	// Healthy is false while the key is benched.
+	Healthy bool `json:"healthy"`
+	// BenchedUntil is the time the key is benched until. It is nil if the key
+	// is not benched.
+	BenchedUntil *time.Time `json:"benched_until,omitempty"`
+	// InFlight is the number of requests in flight with the key.
+	InFlight int `json:"in_flight"`
+	// Requests is the number of requests made with the key.
+	Requests int64 `json:"requests"`
+	// Benched is the number of times the key was benched.
+	Benched int64 `json:"benched"`
+	// LastStatus is the HTTP status code of the last response to a request
+	// made with the key.
+	LastStatus int `json:"last_status,omitempty"`
+}
+
+// KeyPool spreads the requests of a client over several API keys. Keys that
+// get 429 rate limit or 401 authentication errors are benched: they are not
+// selected until the bench time or the Retry-After time of the response has
+// passed, unless all keys are benched. It is safe for concurrent use and can
+// be shared by clients.
+type KeyPool struct {
+	mu        sync.Mutex
+	selection KeySelection
+	benchFor  time.Duration
+	keys      []*poolKey
+	next      int
+	now       func() time.Time
+}
+
+type poolKey struct {
+	PoolKey
+	health KeyHealth
+	// benchedUntil is the time the key is benched until.
+	benchedUntil time.Time
+}
+
+// NewKeyPool creates a pool of the keys that selects keys with selection and
+// benches failing keys for benchFor, or one minute if benchFor is zero.
+func NewKeyPool(selection KeySelection, benchFor time.Duration, keys ...PoolKey) *KeyPool {
+	if benchFor <= 0 {
+		benchFor = defaultBenchDuration
+	}
+	p := &KeyPool{selection: selection, benchFor: benchFor, now: time.Now}
+	for _, key := range keys {
+		if key.Name == "" {
+			key.Name = keyFingerprint(key.APIKey)
+		}
+		p.keys = append(p.keys, &poolKey{PoolKey: key, health: KeyHealth{Name: key.Name}})
+	}
+	return p
+}
+
+// WithKeyPool makes the client send every request with a key selected from
+// the pool. A request that gets a 429 or 401 error is retried with another
+// healthy key. Budgets scoped to API keys apply to the key of the pool the
+// request is sent with.
+func WithKeyPool(pool *KeyPool) Option {
+	return func(o *openAI) {
+		o.keyPool = pool
+	}
+}
+
+// Health returns the health of the keys in the order of the pool.
+func (p *KeyPool) Health() []KeyHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	health := make([]KeyHealth, len(p.keys))
+	for i, k := range p.keys {
+		health[i] = k.health
+		health[i].Healthy = !now.Before(k.benchedUntil)
+		if !health[i].Healthy {
+			benchedUntil := k.benchedUntil
+			health[i].BenchedUntil = &benchedUntil
+		}
+	}
+	return health
+}
+
+// acquire selects the key of a request, or returns nil if the pool is nil or
+// empty.
+// The key must be released once the response is received.
+func (p *KeyPool) acquire() *poolKey {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.keys) == 0 {
+		return nil
+	}
+	now := p.now()
+	var best *poolKey
+	bestIdx := 0
+	for i := range p.keys {
+		idx := (p.next + i) % len(p.keys)
+		k := p.keys[idx]
+		if now.Before(k.benchedUntil) {
+			continue
+		}
+		if best == nil || (p.selection == LeastLoaded && k.health.InFlight < best.health.InFlight) {
+			best, bestIdx = k, idx
+			if p.selection == RoundRobin {
+				break
+			}
+		}
+	}
+	if best == nil {
+		// All keys are benched; use the key that recovers first.
+		for idx, k := range p.keys {
+			if best == nil || k.benchedUntil.Before(best.benchedUntil) {
+				best, bestIdx = k, idx
+			}
+		}
+	}
+	p.next = bestIdx + 1
+	best.health.InFlight++
+	best.health.Requests++
+	return best
+}
+
+// release records the response to a request made with the key and benches
+// the key if the response is a 429 or 401 error. The status is zero if no
+// response was received.
+func (p *KeyPool) release(k *poolKey, status int, header http.Header) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	k.health.InFlight--
+	if status == 0 {
+		return
+	}
+	k.health.LastStatus = status
+	if !benchStatus(status) {
+		return
+	}
+	benchFor := p.benchFor
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds > 0 {
+		benchFor = time.Duration(seconds) * time.Second
+	}
+	k.benchedUntil = p.now().Add(benchFor)
+	k.health.Benched++
+}
+
+// available reports whether the pool has a key that is not benched.
+func (p *KeyPool) available() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	for _, k := range p.keys {
+		if !now.Before(k.benchedUntil) {
+			return true
+		}
+	}
+	return false
+}
+
+// size returns the number of keys of the pool.
+func (p *KeyPool) size() int {
+	return len(p.keys)
+}
+
+// benchStatus reports whether a response with the status benches its key.
+func benchStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusUnauthorized
+}
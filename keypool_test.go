@@ -0,0 +1,199 @@
+package openai_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaiserver"
+	"github.com/noclue/openai/openaitest"
+)
+
+// keyServer serves the fake API, rejecting sk-limited with 429 and
+// sk-revoked with 401, and records the keys of the requests.
+type keyServer struct {
+	*httptest.Server
+	mu   sync.Mutex
+	keys []string
+	// block, if set, is called with the key before a request is served.
+	block func(key string)
+}
+
+func newKeyServer(t *testing.T) *keyServer {
+	t.Helper()
+	s := &keyServer{}
+	handler := openaiserver.NewHandler(openaitest.NewFake())
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		s.keys = append(s.keys, key)
+		block := s.block
+		s.mu.Unlock()
+		if block != nil {
+			block(key)
+		}
+		switch key {
+		case "sk-limited":
+			w.Header().Set("Retry-After", "30")
+			openaiserver.WriteError(w, &openai.APIError{StatusCode: http.StatusTooManyRequests, Type: "requests", Message: "Rate limit reached"})
+		case "sk-revoked":
+			openaiserver.WriteError(w, &openai.APIError{StatusCode: http.StatusUnauthorized, Type: "invalid_request_error", Message: "Incorrect API key provided"})
+		default:
+			handler.ServeHTTP(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *keyServer) usedKeys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.keys...)
+}
+
+func TestKeyPoolRoundRobin(t *testing.T) {
+	t.Parallel()
+	server := newKeyServer(t)
+	pool := openai.NewKeyPool(openai.RoundRobin, 0, openai.PoolKey{Name: "a", APIKey: "sk-a"}, openai.PoolKey{Name: "b", APIKey: "sk-b"})
+	client := openai.NewOpenAI("", openai.WithBaseURL(server.URL), openai.WithKeyPool(pool))
+	for i := 0; i < 3; i++ {
+		if _, err := client.Models(context.Background()); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+	}
+	if keys := strings.Join(server.usedKeys(), ","); keys != "sk-a,sk-b,sk-a" {
+		t.Errorf("Expected keys in turn, got %v", keys)
+	}
+	health := pool.Health()
+	if health[0].Requests != 2 || health[1].Requests != 1 || !health[0].Healthy || health[0].LastStatus != http.StatusOK {
+		t.Errorf("Expected healthy keys with 2 and 1 requests, got %#v", health)
+	}
+}
+
+func TestKeyPoolBudgets(t *testing.T) {
+	t.Parallel()
+	server := newKeyServer(t)
+	tracker, err := openai.NewBudgetTracker(filepath.Join(t.TempDir(), "budgets.json"), openai.DefaultPricing,
+		openai.Budget{Name: "per-key", Scope: openai.BudgetScopeAPIKey, Key: "sk-b", Period: openai.Daily, MaxTokens: 6}) // the estimate of one edit
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	pool := openai.NewKeyPool(openai.RoundRobin, 0, openai.PoolKey{APIKey: "sk-a"}, openai.PoolKey{APIKey: "sk-b"})
+	client := openai.NewOpenAI("sk-b", openai.WithBaseURL(server.URL), openai.WithKeyPool(pool), openai.WithBudgetTracker(tracker))
+	req := openai.EditRequest{Input: "blah-blah"}
+	// The edits sent with sk-a are not charged to the budget of sk-b, the key
+	// the client was created with.
+	for i := 0; i < 2; i++ {
+		if _, err := client.Edit(context.Background(), req); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+	}
+	if _, err := client.Edit(context.Background(), req); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if _, err := client.Edit(context.Background(), req); !errors.Is(err, openai.ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded for sk-b, got %#v", err)
+	}
+	if keys := strings.Join(server.usedKeys(), ","); keys != "sk-a,sk-b,sk-a" {
+		t.Errorf("Expected no request with the exhausted key, got %v", keys)
+	}
+}
+
+func TestKeyPoolBench(t *testing.T) {
+	t.Parallel()
+	server := newKeyServer(t)
+	pool := openai.NewKeyPool(openai.RoundRobin, 0,
+		openai.PoolKey{Name: "limited", APIKey: "sk-limited"},
+		openai.PoolKey{Name: "revoked", APIKey: "sk-revoked"},
+		openai.PoolKey{Name: "good", APIKey: "sk-good"})
+	var attempts int
+	countAttempts := func(next openai.Handler) openai.Handler {
+		return func(ctx context.Context, call *openai.Call) error {
+			err := next(ctx, call)
+			attempts = call.Attempts
+			return err
+		}
+	}
+	client := openai.NewOpenAI("", openai.WithBaseURL(server.URL), openai.WithKeyPool(pool), openai.WithMiddleware(countAttempts))
+
+	res, err := client.Edit(context.Background(), openai.EditRequest{Input: "blah-blah"})
+	if err != nil || res.Choices[0].Text != "blah-blah" {
+		t.Fatalf("Expected edit, got %#v, %#v", res, err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+	if _, err := client.Edit(context.Background(), openai.EditRequest{Input: "blah-blah"}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if keys := strings.Join(server.usedKeys(), ","); keys != "sk-limited,sk-revoked,sk-good,sk-good" {
+		t.Errorf("Expected benched keys to be skipped, got %v", keys)
+	}
+	health := pool.Health()
+	for _, h := range health[:2] {
+		if h.Healthy || h.Benched != 1 || h.BenchedUntil == nil {
+			t.Errorf("Expected benched key, got %#v", h)
+		}
+	}
+	if health[0].LastStatus != http.StatusTooManyRequests || health[1].LastStatus != http.StatusUnauthorized {
+		t.Errorf("Expected 429 and 401 statuses, got %#v", health)
+	}
+	if !health[2].Healthy || health[2].Requests != 2 {
+		t.Errorf("Expected healthy key with 2 requests, got %#v", health[2])
+	}
+	if data, _ := json.Marshal(health[2]); strings.Contains(string(data), "benched_until") {
+		t.Errorf("Expected no bench time for a healthy key, got %s", data)
+	}
+
+	limited := openai.NewOpenAI("", openai.WithBaseURL(server.URL),
+		openai.WithKeyPool(openai.NewKeyPool(openai.RoundRobin, 0, openai.PoolKey{APIKey: "sk-limited"})))
+	_, err = limited.Models(context.Background())
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 error once all keys are benched, got %#v", err)
+	}
+}
+
+func TestKeyPoolLeastLoaded(t *testing.T) {
+	t.Parallel()
+	server := newKeyServer(t)
+	arrived, release := make(chan struct{}), make(chan struct{})
+	server.block = func(key string) {
+		if key == "sk-a" {
+			close(arrived)
+			<-release
+		}
+	}
+	pool := openai.NewKeyPool(openai.LeastLoaded, 0, openai.PoolKey{APIKey: "sk-a"}, openai.PoolKey{APIKey: "sk-b"})
+	client := openai.NewOpenAI("", openai.WithBaseURL(server.URL), openai.WithKeyPool(pool))
+
+	done := make(chan error)
+	go func() {
+		_, err := client.Models(context.Background())
+		done <- err
+	}()
+	<-arrived
+	for i := 0; i < 2; i++ {
+		if _, err := client.Models(context.Background()); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+	}
+	if health := pool.Health(); health[0].InFlight != 1 {
+		t.Errorf("Expected 1 request in flight, got %#v", health[0])
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if keys := strings.Join(server.usedKeys(), ","); keys != "sk-a,sk-b,sk-b" {
+		t.Errorf("Expected the idle key to be selected, got %v", keys)
+	}
+}
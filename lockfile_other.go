@@ -0,0 +1,9 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package openai
+
+// lockFile does not lock files on this platform, where processes must not
+// share a locked file.
+func lockFile(path string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,210 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// redacted replaces secrets and redacted content in logs.
+const redacted = "[REDACTED]"
+
+// redactedHeaders are the HTTP headers that are never logged.
+var redactedHeaders = []string{"Authorization", "Api-Key", "OpenAI-Organization", "OpenAI-Project"}
+
+// promptFields are the JSON fields of requests and responses that carry
+// prompt content or text generated from it.
+var promptFields = map[string]bool{
+	"prompt":      true,
+	"suffix":      true,
+	"input":       true,
+	"instruction": true,
+	"text":        true,
+}
+
+// LogOptions configures what a client logs.
+type LogOptions struct {
+	// Headers enables logging of HTTP request and response headers at debug
+	// level. The Authorization, api-key, OpenAI-Organization and
+	// OpenAI-Project headers are always redacted.
+	Headers bool
+	// Bodies enables logging of HTTP request and response bodies at debug
+	// level. The content of multipart requests is not logged.
+	Bodies bool
+	// RedactPrompts redacts prompts, inputs, instructions and generated text
+	// in logged bodies.
+	RedactPrompts bool
+}
+
+// WithLogger makes the client log every call to logger. A call is logged at
+// info level with its operation, method, endpoint, status, latency, request
+// ID, attempts and token usage, or at error level if it fails. Headers and
+// bodies are logged at debug level if enabled by options.
+func WithLogger(logger *slog.Logger, options LogOptions) Option {
+	return func(o *openAI) {
+		o.logger = logger
+		o.logOptions = options
+	}
+}
+
+// logging logs the calls passing through it.
+func (o *openAI) logging(next Handler) Handler {
+	return func(ctx context.Context, call *Call) error {
+		start := time.Now()
+		err := next(ctx, call)
+		attrs := []slog.Attr{
+			slog.String("operation", call.Operation),
+			slog.String("method", call.Method),
+			slog.String("endpoint", call.Endpoint),
+			slog.Int("status", call.StatusCode),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("request_id", call.RequestID),
+			slog.Int("attempts", call.Attempts),
+		}
+		if id := call.Header.Get("X-Request-ID"); id != "" && id != call.RequestID {
+			attrs = append(attrs, slog.String("response_request_id", id))
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+			o.logger.LogAttrs(ctx, slog.LevelError, "openai call failed", attrs...)
+			return err
+		}
+		if rec, ok := callUsage(call); ok {
+			if rec.Model != "" {
+				attrs = append(attrs, slog.String("model", rec.Model))
+			}
+			if rec.Usage.TotalTokens > 0 {
+				attrs = append(attrs,
+					slog.Int("prompt_tokens", rec.Usage.PropmtTokens),
+					slog.Int("completion_tokens", rec.Usage.CompletionTokens),
+					slog.Int("total_tokens", rec.Usage.TotalTokens))
+			}
+			if rec.Images > 0 {
+				attrs = append(attrs, slog.Int("images", rec.Images))
+			}
+		}
+		o.logger.LogAttrs(ctx, slog.LevelInfo, "openai call", attrs...)
+		return nil
+	}
+}
+
+// logRequest logs the headers and body of an HTTP request if enabled.
+func (o *openAI) logRequest(req *http.Request) {
+	if !o.debugEnabled(req.Context()) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", req.URL.String()),
+	}
+	if o.logOptions.Headers {
+		attrs = append(attrs, slog.Any("headers", redactHeaders(req.Header)))
+	}
+	if o.logOptions.Bodies && req.GetBody != nil {
+		attrs = append(attrs, slog.String("body", o.loggedBody(req.Header, req.GetBody)))
+	}
+	o.logger.LogAttrs(req.Context(), slog.LevelDebug, "openai HTTP request", attrs...)
+}
+
+// logResponse logs the headers and body of an HTTP response if enabled. The
+// body is buffered so it can still be read after logging.
+func (o *openAI) logResponse(ctx context.Context, resp *http.Response) error {
+	if !o.debugEnabled(ctx) {
+		return nil
+	}
+	attrs := []slog.Attr{slog.Int("status", resp.StatusCode)}
+	if o.logOptions.Headers {
+		attrs = append(attrs, slog.Any("headers", redactHeaders(resp.Header)))
+	}
+	if o.logOptions.Bodies && resp.Body != nil {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("openai: HTTP response read error: %w", err)
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		attrs = append(attrs, slog.String("body", o.loggedBody(resp.Header, func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		})))
+	}
+	o.logger.LogAttrs(ctx, slog.LevelDebug, "openai HTTP response", attrs...)
+	return nil
+}
+
+// debugEnabled reports whether headers or bodies should be logged.
+func (o *openAI) debugEnabled(ctx context.Context) bool {
+	return o.logger != nil &&
+		(o.logOptions.Headers || o.logOptions.Bodies) &&
+		o.logger.Enabled(ctx, slog.LevelDebug)
+}
+
+// loggedBody returns the body to log, with prompt content redacted if
+// configured.
+func (o *openAI) loggedBody(header http.Header, getBody func() (io.ReadCloser, error)) string {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		return "[multipart form]"
+	}
+	r, err := getBody()
+	if err != nil {
+		return "[unreadable]"
+	}
+	defer r.Close()
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return "[unreadable]"
+	}
+	if o.logOptions.RedactPrompts {
+		body = redactJSON(body, promptFields)
+	}
+	return string(body)
+}
+
+// redactHeaders returns a copy of header with secrets redacted.
+func redactHeaders(header http.Header) http.Header {
+	res := header.Clone()
+	for _, name := range redactedHeaders {
+		if res.Get(name) != "" {
+			res.Set(name, redacted)
+		}
+	}
+	return res
+}
+
+// redactJSON replaces the values of the given fields anywhere in the JSON
+// document. Documents that are not valid JSON are redacted entirely.
+func redactJSON(body []byte, fields map[string]bool) []byte {
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return []byte(redacted)
+	}
+	res, err := json.Marshal(redactValue(doc, fields))
+	if err != nil {
+		return []byte(redacted)
+	}
+	return res
+}
+
+func redactValue(v any, fields map[string]bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			if fields[k] {
+				v[k] = redacted
+			} else {
+				v[k] = redactValue(val, fields)
+			}
+		}
+	case []any:
+		for i, val := range v {
+			v[i] = redactValue(val, fields)
+		}
+	}
+	return v
+}
@@ -0,0 +1,88 @@
+package openai_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/noclue/openai"
+)
+
+func TestWithLogger(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c := openai.NewOpenAI(apiKey,
+		openai.WithHttpClient(&mockHttpClient{response: jsonResponse(http.StatusOK, completionsSuccessResponse)}),
+		openai.WithOrganization("org-secret"),
+		openai.WithLogger(logger, openai.LogOptions{Headers: true, Bodies: true, RedactPrompts: true}))
+	if _, err := c.CreateCompletion(context.Background(), openai.CompletionsRequest{
+		Model:  "text-davinci-003",
+		Prompt: "my secret prompt",
+	}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+
+	logs := buf.String()
+	for _, secret := range []string{apiKey, "org-secret", "my secret prompt", "blah-blah"} {
+		if strings.Contains(logs, secret) {
+			t.Errorf("Expected %q to be redacted, got %s", secret, logs)
+		}
+	}
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 log records, got %d: %s", len(records), logs)
+	}
+	call := records[2]
+	if call["msg"] != "openai call" || call["level"] != "INFO" {
+		t.Errorf("Expected info call record, got %v", call)
+	}
+	if call["operation"] != openai.OperationCreateCompletion {
+		t.Errorf("Expected operation CreateCompletion, got %v", call["operation"])
+	}
+	if call["endpoint"] != "/v1/completions" {
+		t.Errorf("Expected endpoint /v1/completions, got %v", call["endpoint"])
+	}
+	if call["status"] != float64(http.StatusOK) {
+		t.Errorf("Expected status 200, got %v", call["status"])
+	}
+	if call["total_tokens"] != float64(2000) {
+		t.Errorf("Expected 2000 total tokens, got %v", call["total_tokens"])
+	}
+	if call["request_id"] == "" {
+		t.Error("Expected request ID")
+	}
+}
+
+func TestWithLoggerError(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	c := openai.NewOpenAI(apiKey,
+		openai.WithHttpClient(&mockHttpClient{response: jsonResponse(http.StatusBadRequest, errInvalidToken)}),
+		openai.WithLogger(logger, openai.LogOptions{Bodies: true}))
+	if _, err := c.Edit(context.Background(), editsSuccessRequest); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a single log record, got %s", buf.String())
+	}
+	if record["level"] != "ERROR" {
+		t.Errorf("Expected error level, got %v", record["level"])
+	}
+	if !strings.Contains(record["error"].(string), "Incorrect API key provided") {
+		t.Errorf("Expected API error, got %v", record["error"])
+	}
+}
@@ -0,0 +1,55 @@
+package openai
+
+import "context"
+
+// ResponseMetadata describes how the client answered a call. Callers obtain
+// it with WithResponseMetadata.
+type ResponseMetadata struct {
+	// CacheHit is true if the response was served from the client's cache.
+	CacheHit bool
+	// Cacheable is true if the call could be answered from the client's
+	// cache, whether or not it was.
+	Cacheable bool
+	// Model is the model that answered the call, which differs from the
+	// requested model if the client fell back on another model. It is empty
+	// for calls without a model.
+	Model string
+	// Hedged is true if the response was received for a hedge, a duplicate
+	// request sent because the first request was slow.
+	Hedged bool
+	// RequestID is the X-Request-ID sent with the last HTTP request of the
+	// call, either generated or set with WithRequestID.
+	RequestID string
+	// ServerRequestID is the X-Request-ID of the last HTTP response, which
+	// the API assigns to the request.
+	ServerRequestID string
+	// IdempotencyKey is the Idempotency-Key sent with the requests of the
+	// call, either generated or set with WithIdempotencyKey.
+	IdempotencyKey string
+}
+
+type metadataKey struct{}
+
+// WithResponseMetadata returns a context that makes the client fill in the
+// returned metadata when a call made with the context returns. The context
+// should be used for a single call.
+func WithResponseMetadata(ctx context.Context) (context.Context, *ResponseMetadata) {
+	md := &ResponseMetadata{}
+	return context.WithValue(ctx, metadataKey{}, md), md
+}
+
+// setResponseMetadata fills in the metadata of the context, if any, from the
+// returned call.
+func setResponseMetadata(ctx context.Context, call *Call) {
+	md, ok := ctx.Value(metadataKey{}).(*ResponseMetadata)
+	if !ok {
+		return
+	}
+	md.CacheHit = call.CacheHit
+	md.Cacheable = call.cacheable
+	md.Model = call.Model()
+	md.Hedged = call.Hedged
+	md.RequestID = call.RequestID
+	md.ServerRequestID = call.Header.Get("X-Request-ID")
+	md.IdempotencyKey = call.IdempotencyKey
+}
@@ -0,0 +1,204 @@
+package openai
+
+import (
+	"context"
+	"net/http"
+)
+
+// Operation names of the OpenAI interface methods passed to middleware in
+// Call.Operation.
+const (
+	OperationCreateImage           = "CreateImage"
+	OperationCreateImageVariations = "CreateImageVariations"
+	OperationCreateImageEdits      = "CreateImageEdits"
+	OperationCreateCompletion      = "CreateCompletion"
+	OperationEdit                  = "Edit"
+	OperationModels                = "Models"
+	OperationModeration            = "Moderation"
+)
+
+// Call is a single call of an OpenAI interface method passing through the
+// middleware chain.
+type Call struct {
+	// Operation is the name of the called method, e.g.
+	// OperationCreateCompletion.
+	Operation string
+	// Request is a pointer to the typed request of the method, e.g.
+	// *CompletionsRequest. It is nil for Models. Middleware may modify the
+	// request before calling the next handler.
+	Request any
+	// Response is a pointer to the typed response of the method, e.g.
+	// *CompletionsResponse. It holds the decoded response once the next
+	// handler returns without error. Middleware that does not call the next
+	// handler fills it in itself. It must not be replaced with a value of a
+	// different type.
+	Response any
+	// Method is the HTTP method of the last HTTP request.
+	Method string
+	// Endpoint is the URL path of the last HTTP request, e.g.
+	// "/v1/completions".
+	Endpoint string
+	// StatusCode is the HTTP status code of the last response. It is zero if
+	// no HTTP response was received.
+	StatusCode int
+	// Header is the HTTP header of the last response.
+	Header http.Header
+	// RequestID is the X-Request-ID of the last HTTP request.
+	RequestID string
+	// IdempotencyKey is the Idempotency-Key of the POST requests of the call.
+	// It is generated once per call unless set with WithIdempotencyKey, so
+	// retries of a request reuse it. Middleware that changes the request
+	// before retrying it should clear it, or replace it with a key derived
+	// from it if it was set with WithIdempotencyKey.
+	IdempotencyKey string
+	// Attempts is the number of HTTP requests sent for the call.
+	Attempts int
+	// CacheHit is true if the response was served from the client's cache
+	// without sending a request.
+	CacheHit bool
+	// Coalesced is true if the call shared the HTTP request of a concurrent
+	// identical call.
+	Coalesced bool
+	// Hedged is true if the call was answered by a hedge, a duplicate
+	// request sent because the first request was slow.
+	Hedged bool
+
+	// cacheable is true if the call could be answered from the client's
+	// cache.
+	cacheable bool
+	// reservation is the budget reservation of the last request of the call.
+	reservation *BudgetReservation
+	// apiKey is the API key of the requests of the call that are not sent
+	// with a key of a key pool, once provided.
+	apiKey string
+}
+
+// Model returns the model requested by the call. Images calls are attributed
+// to the "dall-e" model. It is empty for Models calls and for moderation
+// calls that use the default model.
+func (c *Call) Model() string {
+	switch req := c.Request.(type) {
+	case *CompletionsRequest:
+		return req.Model
+	case *EditRequest:
+		return req.Model
+	case *ModerationRequest:
+		return req.Model
+	case *CreateImageReq, *CreateImageVariationsReq, *CreateImageEditsReq:
+		return imageModel
+	default:
+		return ""
+	}
+}
+
+// Usage returns the usage of a successful call and whether the call has usage
+// to report. The Tags of the record are not set.
+func (c *Call) Usage() (UsageRecord, bool) {
+	return callUsage(c)
+}
+
+// Handler handles a call of an OpenAI interface method.
+type Handler func(ctx context.Context, call *Call) error
+
+// Middleware wraps a handler to observe, modify or short-circuit calls. It
+// may return an error without calling next, for example.
+type Middleware func(next Handler) Handler
+
+// WithMiddleware adds middleware to the client. Middleware is applied in the
+// order given: the first middleware sees every call first and its result
+// last. Moderation guards, model fallbacks, caching, request coalescing,
+// hedging, logging, budgets and usage accounting are applied after all
+// middleware, so a call answered by middleware is neither moderated, retried,
+// cached, coalesced, hedged, logged, charged nor recorded.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(o *openAI) {
+		o.middleware = append(o.middleware, middleware...)
+	}
+}
+
+type callKey struct{}
+
+// callFromContext returns the call being handled, or nil if there is none.
+func callFromContext(ctx context.Context) *Call {
+	call, _ := ctx.Value(callKey{}).(*Call)
+	return call
+}
+
+// invoke passes the call through the client's middleware chain to send, which
+// makes the HTTP request of the call.
+func (o *openAI) invoke(ctx context.Context, call *Call, send Handler) error {
+	md := ctx
+	ctx = takeIdempotencyKey(ctx, call)
+	h := Handler(func(ctx context.Context, call *Call) error {
+		return send(context.WithValue(ctx, callKey{}, call), call)
+	})
+	h = o.accounting(h)
+	if o.logger != nil {
+		h = o.logging(h)
+	}
+	if o.hedger != nil {
+		h = o.hedging(h)
+	}
+	if o.coalescer != nil {
+		h = o.coalescing(h)
+	}
+	if o.cache != nil {
+		h = o.caching(h)
+	}
+	if len(o.fallbacks) > 0 {
+		h = o.fallback(h)
+	}
+	if o.guard != nil {
+		h = o.guarding(h)
+	}
+	for i := len(o.middleware) - 1; i >= 0; i-- {
+		h = o.middleware[i](h)
+	}
+	err := h(ctx, call)
+	setResponseMetadata(md, call)
+	return err
+}
+
+// accounting records the usage of a call once it succeeds with the client's
+// usage accountant and budget tracker. The budgets are checked by the send
+// handler, with the API key of the request, and the estimated usage of the
+// call is reserved in them while it is in flight.
+func (o *openAI) accounting(next Handler) Handler {
+	return func(ctx context.Context, call *Call) error {
+		err := next(ctx, call)
+		reservation := call.reservation
+		call.reservation = nil
+		rec, ok := callUsage(call)
+		if err != nil || !ok {
+			if reservation != nil {
+				reservation.Release()
+			}
+			return err
+		}
+		o.recordUsage(ctx, reservation, rec)
+		return nil
+	}
+}
+
+// reserveBudget checks the client's budgets for a request of the call made
+// with the API key and reserves the estimated usage of the call, in place of
+// the reservation of a previous request of the call.
+func (o *openAI) reserveBudget(call *Call, apiKey string) error {
+	if o.budget == nil || call == nil {
+		return nil
+	}
+	estimate, ok := estimateUsage(call)
+	if !ok {
+		return nil
+	}
+	if call.reservation != nil {
+		call.reservation.Release()
+		call.reservation = nil
+	}
+	reservation, err := o.budget.Check(apiKey, estimate)
+	if err != nil {
+		return err
+	}
+	call.reservation = reservation
+	return nil
+}
@@ -0,0 +1,132 @@
+package openai_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/noclue/openai"
+)
+
+// TestMiddleware tests that middleware sees calls in order with the typed
+// request and response, and can modify requests.
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+	var order []string
+	trace := func(name string) openai.Middleware {
+		return func(next openai.Handler) openai.Handler {
+			return func(ctx context.Context, call *openai.Call) error {
+				order = append(order, name+":"+call.Operation)
+				err := next(ctx, call)
+				order = append(order, name+":done")
+				return err
+			}
+		}
+	}
+	rewriteModel := func(next openai.Handler) openai.Handler {
+		return func(ctx context.Context, call *openai.Call) error {
+			call.Request.(*openai.EditRequest).Model = "rewritten"
+			return next(ctx, call)
+		}
+	}
+	var observed *openai.Call
+	observe := func(next openai.Handler) openai.Handler {
+		return func(ctx context.Context, call *openai.Call) error {
+			err := next(ctx, call)
+			observed = call
+			return err
+		}
+	}
+	httpClient := &mockHttpClient{
+		response: jsonResponse(http.StatusOK, editsSuccessResponse),
+		requestValidator: func(req *http.Request) {
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Errorf("Expected nil, got %#v", err)
+			}
+			var request map[string]any
+			if err := json.Unmarshal(body, &request); err != nil {
+				t.Errorf("Expected nil, got %#v", err)
+			}
+			if request["model"] != "rewritten" {
+				t.Errorf("Expected rewritten, got %s", request["model"])
+			}
+		},
+	}
+	c := openai.NewOpenAI(apiKey,
+		openai.WithHttpClient(httpClient),
+		openai.WithMiddleware(trace("outer"), trace("inner")),
+		openai.WithMiddleware(rewriteModel, observe))
+
+	edit, err := c.Edit(context.Background(), editsSuccessRequest)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if edit.Choices[0].Text != "blah-blah" {
+		t.Errorf("Expected 'blah-blah', got %s", edit.Choices[0].Text)
+	}
+	want := []string{"outer:Edit", "inner:Edit", "inner:done", "outer:done"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("Expected %v, got %v", want, order)
+	}
+	if observed.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", observed.StatusCode)
+	}
+	if observed.Attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", observed.Attempts)
+	}
+	if observed.RequestID == "" {
+		t.Error("Expected request ID")
+	}
+	if observed.Response.(*openai.EditResponse) != edit {
+		t.Error("Expected the call response to be returned")
+	}
+}
+
+// TestMiddlewareShortCircuit tests that middleware can answer or refuse calls
+// without sending HTTP requests.
+func TestMiddlewareShortCircuit(t *testing.T) {
+	t.Parallel()
+	errPolicy := errors.New("denied by policy")
+	httpClient := &mockHttpClient{
+		requestValidator: func(req *http.Request) {
+			t.Errorf("Expected no HTTP request, got %s %s", req.Method, req.URL)
+		},
+	}
+	accountant := openai.NewUsageAccountant(openai.DefaultPricing)
+	c := openai.NewOpenAI(apiKey,
+		openai.WithHttpClient(httpClient),
+		openai.WithUsageAccountant(accountant),
+		openai.WithMiddleware(func(next openai.Handler) openai.Handler {
+			return func(ctx context.Context, call *openai.Call) error {
+				switch call.Operation {
+				case openai.OperationModels:
+					*call.Response.(*openai.ModelsResponse) = openai.ModelsResponse{
+						Object: "list",
+						Data:   []openai.Model{{ID: "cached"}},
+					}
+					return nil
+				default:
+					return errPolicy
+				}
+			}
+		}))
+
+	models, err := c.Models(context.Background())
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if len(models.Data) != 1 || models.Data[0].ID != "cached" {
+		t.Errorf("Expected cached model, got %#v", models.Data)
+	}
+	if _, err := c.CreateImage(context.Background(), openai.CreateImageReq{Prompt: "This is a test"}); !errors.Is(err, errPolicy) {
+		t.Errorf("Expected policy error, got %#v", err)
+	}
+	if accountant.Snapshot().Total.Requests != 0 {
+		t.Error("Expected short-circuited calls not to be recorded")
+	}
+}
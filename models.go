@@ -6,7 +6,7 @@ import (
 	"net/http"
 )
 
-var modelsPath = fmt.Sprintf("%v/%v/models", basePath, apiVersion)
+var modelsPath = fmt.Sprintf("/%v/models", apiVersion)
 
 // ModelsResponse is response of the OpenAI API for the models endpoint
 type ModelsResponse struct {
@@ -36,14 +36,20 @@ type Model struct {
 
 // Models returns the list of models available to the user from the OpenAI API
 func (c *openAI) Models(ctx context.Context) (*ModelsResponse, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, modelsPath, nil)
+	call := &Call{Operation: OperationModels, Response: &ModelsResponse{}}
+	err := c.invoke(ctx, call, func(ctx context.Context, call *Call) error {
+		reqURL, err := c.requestURL(ctx, modelsPath)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+		if err != nil {
+			return fmt.Errorf("openai: HTTP request creation error: %w", err)
+		}
+		return c.makeHttpRequest(req, call.Response)
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	var resp ModelsResponse
-	if err := c.makeHttpRequest(req, &resp); err != nil {
-		return nil, err
-	}
-	return &resp, nil
+	return call.Response.(*ModelsResponse), nil
 }
@@ -5,18 +5,48 @@ import (
 	"fmt"
 )
 
-var moderationPath = fmt.Sprintf("%v/%v/moderations", basePath, apiVersion)
+var moderationPath = fmt.Sprintf("/%v/moderations", apiVersion)
 
 const (
-	CategoryHate            = "hate"
-	CategoryHateThreatening = "hate/threatening"
-	CategorySelfHarm        = "self-harm"
-	CategorySexual          = "sexual"
-	CategorySexualMinors    = "sexual/minors"
-	CategoryViolence        = "violence"
-	CategoryViolenceGraphic = "violence/graphic"
+	CategoryHate                  = "hate"
+	CategoryHateThreatening       = "hate/threatening"
+	CategoryHarassment            = "harassment"
+	CategoryHarassmentThreatening = "harassment/threatening"
+	CategorySelfHarm              = "self-harm"
+	CategorySelfHarmIntent        = "self-harm/intent"
+	CategorySelfHarmInstructions  = "self-harm/instructions"
+	CategorySexual                = "sexual"
+	CategorySexualMinors          = "sexual/minors"
+	CategoryViolence              = "violence"
+	CategoryViolenceGraphic       = "violence/graphic"
+	CategoryIllicit               = "illicit"
+	CategoryIllicitViolent        = "illicit/violent"
 )
 
+// categoryOrder are the known moderation categories in the order of the
+// fields of ModerationCategories. It sets the bits of categoryBit.
+var categoryOrder = [...]string{
+	CategoryHate,
+	CategoryHateThreatening,
+	CategoryHarassment,
+	CategoryHarassmentThreatening,
+	CategorySelfHarm,
+	CategorySelfHarmIntent,
+	CategorySelfHarmInstructions,
+	CategorySexual,
+	CategorySexualMinors,
+	CategoryViolence,
+	CategoryViolenceGraphic,
+	CategoryIllicit,
+	CategoryIllicitViolent,
+}
+
+// Categories returns the known moderation categories in the order of the
+// fields of ModerationCategories.
+func Categories() []string {
+	return append([]string(nil), categoryOrder[:]...)
+}
+
 // ModerationRequest is the request body for the OpenAI API moderation endpoint
 type ModerationRequest struct {
 	// Input is the text to be moderated
@@ -42,19 +72,24 @@ type ModerationResponse struct {
 }
 
 type ModerationResult struct {
-	// Categories is the list of categories
-	Categories map[string]bool `json:"categories"`
-	// CategoryScores is the list of category scores
-	CategoryScores map[string]float64 `json:"category_scores"`
+	// Categories tells which categories the text is flagged for. Use
+	// Categories.Get or Categories.Map to look categories up by name.
+	Categories ModerationCategories `json:"categories"`
+	// CategoryScores are the scores of the text per category. Use
+	// CategoryScores.Get or CategoryScores.Map to look scores up by name.
+	CategoryScores ModerationCategoryScores `json:"category_scores"`
 	// Flagged is true if the text is flagged
 	Flagged bool `json:"flagged"`
 }
 
 // Moderation returns the moderation results for the given text from the OpenAI API
 func (c *openAI) Moderation(ctx context.Context, req ModerationRequest) (*ModerationResponse, error) {
-	res := &ModerationResponse{}
-	if err := c.makeJSONRequest(ctx, moderationPath, req, &res); err != nil {
+	call := &Call{Operation: OperationModeration, Request: &req, Response: &ModerationResponse{}}
+	err := c.invoke(ctx, call, func(ctx context.Context, call *Call) error {
+		return c.makeJSONRequest(ctx, moderationPath, call.Request, call.Response)
+	})
+	if err != nil {
 		return nil, err
 	}
-	return res, nil
+	return call.Response.(*ModerationResponse), nil
 }
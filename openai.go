@@ -3,8 +3,11 @@ package openai
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"runtime"
+	"strings"
+	"time"
 )
 
 const (
@@ -47,31 +50,103 @@ type openAI struct {
 	// organization is the organization to use for the requests to the OpenAI API.
 	// See https://beta.openai.com/docs/api-reference/requesting-organization
 	organization string
+	// project is the project to use for the requests to the OpenAI API.
+	project string
+	// headers are the default headers of every request.
+	headers http.Header
+	// baseURL is the URL of the OpenAI API without the trailing slash.
+	baseURL string
+	// usage accumulates the usage of the requests made by the client.
+	usage *UsageAccountant
+	// budget enforces the spending budgets of the client.
+	budget *BudgetTracker
+	// middleware is the chain of middleware every call passes through.
+	middleware []Middleware
+	// logger logs the calls of the client. It is nil if logging is disabled.
+	logger *slog.Logger
+	// logOptions configures what is logged.
+	logOptions LogOptions
+	// cache stores the responses of cacheable calls. It is nil if caching is
+	// disabled.
+	cache CacheStore
+	// cacheTTL is the time responses are cached for.
+	cacheTTL time.Duration
+	// coalescer shares in-flight calls with identical calls. It is nil if
+	// coalescing is disabled.
+	coalescer *coalescer
+	// keyPool selects the API key of every request. It is nil if the client
+	// uses APIKey.
+	keyPool *KeyPool
+	// fallbacks are the model fallback policies of the client.
+	fallbacks []FallbackPolicy
+	// hedger hedges slow calls. It is nil if hedging is disabled.
+	hedger *Hedger
+	// breaker fails requests to failing endpoints fast. It is nil if the
+	// client has no circuit breaker.
+	breaker *CircuitBreaker
+	// azure configures the Azure OpenAI API. It is nil for the OpenAI API.
+	azure *AzureConfig
+	// credentials provides the API key of every request. It is nil if the
+	// client uses APIKey.
+	credentials CredentialProvider
+	// guard moderates the prompts and generated text of calls. It is nil if
+	// the client has no moderation guard.
+	guard *moderationGuard
 }
 
-type openAIOption func(*openAI)
+// Option configures an OpenAI API client created with NewOpenAI.
+type Option func(*openAI)
 
 // WithHttpClient sets the http client to use to make requests to the OpenAI
 // API. One can set request and response timeouts, for example.
-func WithHttpClient(client HttpClient) openAIOption {
+func WithHttpClient(client HttpClient) Option {
 	return func(o *openAI) {
 		o.Client = client
 	}
 }
 
+// WithBaseURL sets the URL of the OpenAI API, e.g. to use a test server or an
+// OpenAI compatible gateway. The default is https://api.openai.com.
+func WithBaseURL(baseURL string) Option {
+	return func(o *openAI) {
+		o.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
 // WithOrganization sets the organization to use for the requests to the OpenAI
 // API. See https://beta.openai.com/docs/api-reference/requesting-organization
-func WithOrganization(organization string) openAIOption {
+func WithOrganization(organization string) Option {
 	return func(o *openAI) {
 		o.organization = organization
 	}
 }
 
+// WithUsageAccountant attaches a usage accountant to the client. The usage of
+// every successful request is recorded with it.
+func WithUsageAccountant(accountant *UsageAccountant) Option {
+	return func(o *openAI) {
+		o.usage = accountant
+	}
+}
+
+// WithBudgetTracker makes the client refuse requests that would exceed a
+// budget of the tracker with ErrBudgetExceeded, and requests to models without
+// a price under a cost budget with ErrUnknownPrice. The estimated usage of every
+// request is reserved in the budgets while it is in flight, and replaced with
+// its actual usage once it succeeds. Budgets scoped to API keys apply to the
+// key each request is sent with.
+func WithBudgetTracker(tracker *BudgetTracker) Option {
+	return func(o *openAI) {
+		o.budget = tracker
+	}
+}
+
 // NewOpenAI creates a new OpenAI API client
-func NewOpenAI(apiKey string, options ...openAIOption) OpenAI {
+func NewOpenAI(apiKey string, options ...Option) OpenAI {
 	res := &openAI{
-		APIKey: apiKey,
-		Client: http.DefaultClient,
+		APIKey:  apiKey,
+		Client:  http.DefaultClient,
+		baseURL: basePath,
 	}
 	for _, option := range options {
 		option(res)
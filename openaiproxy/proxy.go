@@ -0,0 +1,314 @@
+// Package openaiproxy provides an HTTP proxy for the OpenAI API. Internal
+// clients send OpenAI API requests to the proxy, which forwards them with an
+// openai.OpenAI client holding the real API key, so the clients never see
+// the key. The proxy can rate limit clients and write an audit log of the
+// requests, which reports the cache hits of clients created with
+// openai.WithCache.
+package openaiproxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaiserver"
+)
+
+// maxBodySize is the maximum size of request bodies accepted by the proxy.
+const maxBodySize = 32 << 20
+
+// Cache states of audit records.
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+// Proxy is an http.Handler serving the OpenAI API by forwarding requests to
+// an openai.OpenAI client. Incoming API keys are never forwarded.
+type Proxy struct {
+	handler http.Handler
+	clients []clientToken
+
+	rate    float64
+	burst   int
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+
+	auditMu sync.Mutex
+	audit   io.Writer
+	now     func() time.Time
+}
+
+// Option configures a Proxy.
+type Option func(*Proxy)
+
+// WithClients restricts the proxy to clients sending one of the bearer tokens
+// of clients, which maps the tokens to client names. Other requests are
+// rejected with 401. Without clients any request is accepted and clients are
+// identified by their IP address. Tokens are compared in constant time, so
+// response times do not reveal how much of a token a request got right.
+func WithClients(clients map[string]string) Option {
+	return func(p *Proxy) {
+		p.clients = make([]clientToken, 0, len(clients))
+		for token, name := range clients {
+			p.clients = append(p.clients, clientToken{sum: sha256.Sum256([]byte(token)), name: name})
+		}
+	}
+}
+
+// clientToken is the SHA-256 digest of the token of a client. Digests have the
+// same length whatever the length of the tokens, so comparing them takes the
+// same time.
+type clientToken struct {
+	sum  [sha256.Size]byte
+	name string
+}
+
+// WithRateLimit limits every client to perSecond requests per second on
+// average with bursts of up to burst requests. Requests over the limit are
+// rejected with 429 and a Retry-After header.
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(p *Proxy) {
+		p.rate = perSecond
+		p.burst = max(burst, 1)
+	}
+}
+
+// WithAuditLog writes an AuditRecord of every request as a line of JSON to w.
+func WithAuditLog(w io.Writer) Option {
+	return func(p *Proxy) {
+		p.audit = w
+	}
+}
+
+// New creates a proxy forwarding requests to client. Responses are cached by
+// the client if it was created with openai.WithCache.
+func New(client openai.OpenAI, options ...Option) *Proxy {
+	p := &Proxy{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+	for _, option := range options {
+		option(p)
+	}
+	p.handler = openaiserver.NewHandler(client)
+	return p
+}
+
+// AuditRecord is a request handled by the proxy. Prompts and other request
+// contents are not recorded.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Client is the name of the client, or its IP address if the proxy has
+	// no configured clients. It is empty for rejected unknown clients.
+	Client    string `json:"client"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Model     string `json:"model,omitempty"`
+	User      string `json:"user,omitempty"`
+	Status    int    `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	// Cache is CacheHit or CacheMiss for requests the client could answer
+	// from its cache.
+	Cache     string `json:"cache,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+
+	// metadata is how the client answered the request.
+	metadata *openai.ResponseMetadata
+}
+
+// setCache sets the cache state of the record from the response metadata.
+func (rec *AuditRecord) setCache() {
+	switch {
+	case rec.metadata == nil || !rec.metadata.Cacheable:
+	case rec.metadata.CacheHit:
+		rec.Cache = CacheHit
+	default:
+		rec.Cache = CacheMiss
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := p.now()
+	rec := &AuditRecord{
+		Time:      start,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		RequestID: r.Header.Get("X-Request-ID"),
+	}
+	sw := &statusWriter{ResponseWriter: w, rec: rec}
+	p.serve(sw, r, rec)
+	rec.Status = sw.status
+	rec.LatencyMS = p.now().Sub(start).Milliseconds()
+	p.writeAudit(rec)
+}
+
+func (p *Proxy) serve(w http.ResponseWriter, r *http.Request, rec *AuditRecord) {
+	client, ok := p.client(r)
+	if !ok {
+		openaiserver.WriteError(w, &openai.APIError{
+			StatusCode: http.StatusUnauthorized,
+			Type:       "invalid_request_error",
+			Code:       "invalid_api_key",
+			Message:    "Incorrect API key provided for the proxy.",
+		})
+		return
+	}
+	rec.Client = client
+	if retry, ok := p.allow(client); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		openaiserver.WriteError(w, &openai.APIError{
+			StatusCode: http.StatusTooManyRequests,
+			Type:       "requests",
+			Code:       "rate_limit_exceeded",
+			Message:    fmt.Sprintf("Rate limit of the proxy reached for client %v. Please try again in %v.", client, retry.Round(time.Millisecond)),
+		})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	if r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			openaiserver.WriteError(w, &openai.APIError{
+				StatusCode: http.StatusRequestEntityTooLarge,
+				Type:       "invalid_request_error",
+				Message:    "We could not read the body of your request: " + err.Error(),
+			})
+			return
+		}
+		var fields struct {
+			Model string `json:"model"`
+			User  string `json:"user"`
+		}
+		json.Unmarshal(body, &fields)
+		rec.Model, rec.User = fields.Model, fields.User
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	ctx, md := openai.WithResponseMetadata(r.Context())
+	rec.metadata = md
+	p.handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// client returns the name of the client sending the request and whether it
+// is allowed to use the proxy.
+func (p *Proxy) client(r *http.Request) (string, bool) {
+	if p.clients == nil {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr, true
+		}
+		return host, true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(token))
+	var name string
+	found := 0
+	for _, c := range p.clients {
+		if subtle.ConstantTimeCompare(sum[:], c.sum[:]) == 1 {
+			name, found = c.name, 1
+		}
+	}
+	return name, found == 1
+}
+
+// bucket is the token bucket of a rate limited client.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token from the bucket of the client. If the bucket is empty,
+// it returns false and the time until the next token is available.
+func (p *Proxy) allow(client string) (time.Duration, bool) {
+	if p.rate <= 0 {
+		return 0, true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	p.sweep(now)
+	b, ok := p.buckets[client]
+	if !ok {
+		b = &bucket{tokens: float64(p.burst), last: now}
+		p.buckets[client] = b
+	}
+	b.tokens = math.Min(float64(p.burst), b.tokens+now.Sub(b.last).Seconds()*p.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / p.rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// sweep removes the buckets that have refilled since they were last used,
+// which a client without a bucket gets anew, so that the buckets of clients
+// that went away do not pile up. Buckets take burst/rate to refill, so sweeping
+// more often would find few of them. The caller must hold p.mu.
+func (p *Proxy) sweep(now time.Time) {
+	if now.Sub(p.swept).Seconds() < float64(p.burst)/p.rate {
+		return
+	}
+	p.swept = now
+	for client, b := range p.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*p.rate >= float64(p.burst) {
+			delete(p.buckets, client)
+		}
+	}
+}
+
+func (p *Proxy) writeAudit(rec *AuditRecord) {
+	if p.audit == nil {
+		return
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	p.auditMu.Lock()
+	defer p.auditMu.Unlock()
+	p.audit.Write(append(line, '\n'))
+}
+
+// statusWriter records the status code of the response and reports the cache
+// state of the request in the X-Proxy-Cache header.
+type statusWriter struct {
+	http.ResponseWriter
+	rec    *AuditRecord
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	w.rec.setCache()
+	if w.rec.Cache != "" {
+		w.Header().Set("X-Proxy-Cache", strings.ToUpper(w.rec.Cache))
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
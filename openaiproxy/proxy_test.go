@@ -0,0 +1,167 @@
+package openaiproxy_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaiproxy"
+	"github.com/noclue/openai/openaitest"
+)
+
+// newProxy starts a proxy of a fake and returns the fake, a client of the
+// proxy with the API key and the proxy server.
+func newProxy(t *testing.T, apiKey string, options ...openaiproxy.Option) (*openaitest.Fake, openai.OpenAI, *httptest.Server) {
+	t.Helper()
+	fake := openaitest.NewFake()
+	client, server := proxyClient(t, fake, apiKey, options...)
+	return fake, client, server
+}
+
+// proxyClient starts a proxy of backend and returns a client of the proxy
+// with the API key and the proxy server.
+func proxyClient(t *testing.T, backend openai.OpenAI, apiKey string, options ...openaiproxy.Option) (openai.OpenAI, *httptest.Server) {
+	t.Helper()
+	server := httptest.NewServer(openaiproxy.New(backend, options...))
+	t.Cleanup(server.Close)
+	return openai.NewOpenAI(apiKey, openai.WithBaseURL(server.URL)), server
+}
+
+func TestProxyCache(t *testing.T) {
+	t.Parallel()
+	store := openai.NewMemoryCache(10)
+	var audit bytes.Buffer
+	backend := openaitest.NewServer(openaitest.NewFake())
+	defer backend.Close()
+	fake := backend.Fake
+	client, _ := proxyClient(t, backend.OpenAI(openai.WithCache(store, time.Hour)), "internal", openaiproxy.WithAuditLog(&audit))
+	zero, one := 0.0, 1.0
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		res, err := client.CreateCompletion(ctx, openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "Say this is a test", Temperature: &zero})
+		if err != nil || res.Choices[0].Text != openaitest.CompletionText {
+			t.Fatalf("Expected completion, got %#v, %#v", res, err)
+		}
+		if _, err := client.CreateCompletion(ctx, openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "Say this is a test", Temperature: &one}); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+	}
+	fake.AssertCalled(t, openai.OperationCreateCompletion, 3)
+	if store.Len() != 1 {
+		t.Errorf("Expected 1 cached response, got %d", store.Len())
+	}
+
+	var records []openaiproxy.AuditRecord
+	for _, line := range strings.Split(strings.TrimSpace(audit.String()), "\n") {
+		var rec openaiproxy.AuditRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("Expected JSON audit record, got %q", line)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Expected 4 audit records, got %d", len(records))
+	}
+	if records[0].Cache != openaiproxy.CacheMiss || records[1].Cache != "" || records[2].Cache != openaiproxy.CacheHit {
+		t.Errorf("Expected miss, none and hit, got %#v", records)
+	}
+	if rec := records[2]; rec.Client != "127.0.0.1" || rec.Model != "text-davinci-003" || rec.Path != "/v1/completions" || rec.Status != http.StatusOK {
+		t.Errorf("Expected audit record of the completion, got %#v", rec)
+	}
+	if strings.Contains(audit.String(), "Say this is a test") {
+		t.Error("Expected audit log without prompts")
+	}
+}
+
+func TestProxyClients(t *testing.T) {
+	t.Parallel()
+	var audit bytes.Buffer
+	fake, client, server := newProxy(t, "token-a", openaiproxy.WithClients(map[string]string{"token-a": "billing"}), openaiproxy.WithAuditLog(&audit))
+	if _, err := client.Models(context.Background()); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if !strings.Contains(audit.String(), `"client":"billing"`) {
+		t.Errorf("Expected audit record of client billing, got %q", audit.String())
+	}
+
+	_, err := openai.NewOpenAI("token-b", openai.WithBaseURL(server.URL)).Models(context.Background())
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 error, got %#v", err)
+	}
+	fake.AssertCalled(t, openai.OperationModels, 1)
+}
+
+func TestProxyRateLimit(t *testing.T) {
+	t.Parallel()
+	fake, client, server := newProxy(t, "internal", openaiproxy.WithRateLimit(0.001, 2))
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := client.Models(ctx); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+	}
+	_, err := client.Models(ctx)
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Code != "rate_limit_exceeded" {
+		t.Errorf("Expected 429 error, got %#v", err)
+	}
+	fake.AssertCalled(t, openai.OperationModels, 2)
+
+	resp, err := http.Get(server.URL + "/v1/models")
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %v %v", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestProxyMultipartBodyTooLarge(t *testing.T) {
+	t.Parallel()
+	fake := openaitest.NewFake()
+	proxy := openaiproxy.New(fake)
+
+	// Stream an image of 33 MiB, more than the 32 MiB accepted by the proxy.
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		part, err := form.CreateFormFile("image", "image.png")
+		if err == nil {
+			_, err = io.CopyN(part, zeros{}, 33<<20)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	req := httptest.NewRequest(http.MethodPost, "/v1/images/variations", pr)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+	pr.Close()
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d: %s", rec.Code, rec.Body)
+	}
+	fake.AssertNotCalled(t, openai.OperationCreateImageVariations)
+}
+
+// zeros reads an endless stream of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
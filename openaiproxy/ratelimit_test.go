@@ -0,0 +1,58 @@
+package openaiproxy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/noclue/openai/openaitest"
+)
+
+func TestAllowEvictsRefilledBuckets(t *testing.T) {
+	t.Parallel()
+	p := New(openaitest.NewFake(), WithRateLimit(1, 2))
+	now := time.Unix(0, 0)
+	p.now = func() time.Time { return now }
+
+	for i := 0; i < 100; i++ {
+		if _, ok := p.allow(fmt.Sprintf("10.0.0.%d", i)); !ok {
+			t.Fatalf("Expected the first request of a client to be allowed")
+		}
+	}
+	for i := 0; i < 2; i++ {
+		p.allow("busy")
+	}
+	if _, ok := p.allow("busy"); ok {
+		t.Fatal("Expected the busy client to be limited")
+	}
+	if n := len(p.buckets); n != 101 {
+		t.Fatalf("Expected 101 buckets, got %d", n)
+	}
+
+	// The buckets have not refilled yet, so none is evicted.
+	now = now.Add(time.Second)
+	p.allow("new")
+	if n := len(p.buckets); n != 102 {
+		t.Errorf("Expected 102 buckets before they refill, got %d", n)
+	}
+
+	// The busy client keeps using its bucket, which does not refill.
+	now = now.Add(900 * time.Millisecond)
+	if _, ok := p.allow("busy"); !ok {
+		t.Fatal("Expected the busy client to be allowed after 1.9s")
+	}
+
+	// The idle buckets have refilled, so they are evicted, but the busy
+	// client's bucket is kept and keeps limiting the client.
+	now = now.Add(600 * time.Millisecond)
+	p.allow("other")
+	if _, ok := p.buckets["busy"]; !ok || len(p.buckets) != 2 {
+		t.Errorf("Expected the busy and other buckets to be kept, got %d buckets", len(p.buckets))
+	}
+	if _, ok := p.allow("busy"); !ok {
+		t.Fatal("Expected the kept bucket to hold the refilled token")
+	}
+	if _, ok := p.allow("busy"); ok {
+		t.Error("Expected the kept bucket to limit the busy client")
+	}
+}
@@ -0,0 +1,346 @@
+// Package openaiserver serves the OpenAI API wire format on top of an
+// implementation of the openai.OpenAI interface. It backs test servers, mock
+// servers and proxies that accept requests from any OpenAI API client.
+package openaiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/noclue/openai"
+)
+
+// maxMemory is the size of multipart forms kept in memory while parsing.
+const maxMemory = 32 << 20
+
+// Paths of the served endpoints.
+const (
+	ModelsPath           = "/v1/models"
+	CompletionsPath      = "/v1/completions"
+	EditsPath            = "/v1/edits"
+	ModerationsPath      = "/v1/moderations"
+	ImageGenerationsPath = "/v1/images/generations"
+	ImageVariationsPath  = "/v1/images/variations"
+	ImageEditsPath       = "/v1/images/edits"
+)
+
+// Operations maps the served paths to the operation names of the
+// openai.OpenAI methods that serve them.
+var Operations = map[string]string{
+	ModelsPath:           openai.OperationModels,
+	CompletionsPath:      openai.OperationCreateCompletion,
+	EditsPath:            openai.OperationEdit,
+	ModerationsPath:      openai.OperationModeration,
+	ImageGenerationsPath: openai.OperationCreateImage,
+	ImageVariationsPath:  openai.OperationCreateImageVariations,
+	ImageEditsPath:       openai.OperationCreateImageEdits,
+}
+
+// NewHandler returns a handler that serves the OpenAI API endpoints by calling
+// the methods of backend. Uploaded images are stored in temporary files for
+// the duration of the call. The X-Request-ID and Idempotency-Key of requests
+// are passed on to backend with openai.WithRequestID and
+// openai.WithIdempotencyKey. Errors of backend are written as OpenAI API
+// error responses; see WriteError.
+func NewHandler(backend openai.OpenAI) http.Handler {
+	h := &handler{backend: backend}
+	mux := http.NewServeMux()
+	mux.HandleFunc(ModelsPath, h.models)
+	mux.HandleFunc(CompletionsPath, h.completions)
+	mux.HandleFunc(EditsPath, h.edits)
+	mux.HandleFunc(ModerationsPath, h.moderations)
+	mux.HandleFunc(ImageGenerationsPath, h.imageGenerations)
+	mux.HandleFunc(ImageVariationsPath, h.imageVariations)
+	mux.HandleFunc(ImageEditsPath, h.imageEdits)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, &openai.APIError{
+			StatusCode: http.StatusNotFound,
+			Type:       "invalid_request_error",
+			Message:    fmt.Sprintf("Invalid URL (%v %v)", r.Method, r.URL.Path),
+		})
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if id := r.Header.Get("X-Request-ID"); id != "" {
+			w.Header().Set("X-Request-ID", id)
+			ctx = openai.WithRequestID(ctx, id)
+		}
+		if key := r.Header.Get("Idempotency-Key"); key != "" {
+			ctx = openai.WithIdempotencyKey(ctx, key)
+		}
+		mux.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type handler struct {
+	backend openai.OpenAI
+}
+
+func (h *handler) models(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	resp, err := h.backend.Models(r.Context())
+	writeResult(w, resp, err)
+}
+
+func (h *handler) completions(w http.ResponseWriter, r *http.Request) {
+	var req openai.CompletionsRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	resp, err := h.backend.CreateCompletion(r.Context(), req)
+	writeResult(w, resp, err)
+}
+
+func (h *handler) edits(w http.ResponseWriter, r *http.Request) {
+	var req openai.EditRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	resp, err := h.backend.Edit(r.Context(), req)
+	writeResult(w, resp, err)
+}
+
+func (h *handler) moderations(w http.ResponseWriter, r *http.Request) {
+	var req openai.ModerationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	resp, err := h.backend.Moderation(r.Context(), req)
+	writeResult(w, resp, err)
+}
+
+func (h *handler) imageGenerations(w http.ResponseWriter, r *http.Request) {
+	var req openai.CreateImageReq
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	resp, err := h.backend.CreateImage(r.Context(), req)
+	writeResult(w, resp, err)
+}
+
+func (h *handler) imageVariations(w http.ResponseWriter, r *http.Request) {
+	form, ok := parseForm(w, r)
+	if !ok {
+		return
+	}
+	defer form.RemoveAll()
+	req := openai.CreateImageVariationsReq{}
+	var err error
+	if req.CommonImageReq, err = commonImageReq(form); err != nil {
+		WriteError(w, invalidRequest(err.Error()))
+		return
+	}
+	dir, err := os.MkdirTemp("", "openaiserver")
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	if req.Image, err = saveFile(form, "image", dir); err != nil {
+		WriteError(w, err)
+		return
+	}
+	if req.Image == "" {
+		WriteError(w, invalidRequest("image is a required property"))
+		return
+	}
+	resp, err := h.backend.CreateImageVariations(r.Context(), req)
+	writeResult(w, resp, err)
+}
+
+func (h *handler) imageEdits(w http.ResponseWriter, r *http.Request) {
+	form, ok := parseForm(w, r)
+	if !ok {
+		return
+	}
+	defer form.RemoveAll()
+	req := openai.CreateImageEditsReq{Prompt: formValue(form, "prompt")}
+	var err error
+	if req.CommonImageReq, err = commonImageReq(form); err != nil {
+		WriteError(w, invalidRequest(err.Error()))
+		return
+	}
+	dir, err := os.MkdirTemp("", "openaiserver")
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	if req.Image, err = saveFile(form, "image", dir); err != nil {
+		WriteError(w, err)
+		return
+	}
+	if req.Image == "" {
+		WriteError(w, invalidRequest("image is a required property"))
+		return
+	}
+	if req.Mask, err = saveFile(form, "mask", dir); err != nil {
+		WriteError(w, err)
+		return
+	}
+	resp, err := h.backend.CreateImageEdits(r.Context(), req)
+	writeResult(w, resp, err)
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	WriteError(w, &openai.APIError{
+		StatusCode: http.StatusMethodNotAllowed,
+		Type:       "invalid_request_error",
+		Message:    fmt.Sprintf("Invalid method for URL (%v %v)", r.Method, r.URL.Path),
+	})
+	return false
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, req any) bool {
+	if !allowMethod(w, r, http.MethodPost) {
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		WriteError(w, invalidRequest("We could not parse the JSON body of your request: "+err.Error()))
+		return false
+	}
+	return true
+}
+
+func parseForm(w http.ResponseWriter, r *http.Request) (*multipart.Form, bool) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return nil, false
+	}
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		apiErr := invalidRequest("We could not parse the multipart form of your request: " + err.Error())
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apiErr.StatusCode = http.StatusRequestEntityTooLarge
+		}
+		WriteError(w, apiErr)
+		return nil, false
+	}
+	return r.MultipartForm, true
+}
+
+func formValue(form *multipart.Form, key string) string {
+	if values := form.Value[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func commonImageReq(form *multipart.Form) (openai.CommonImageReq, error) {
+	req := openai.CommonImageReq{
+		Size:           openai.ImageSize(formValue(form, "size")),
+		ResponseFormat: openai.ResponseFormat(formValue(form, "response_format")),
+		User:           formValue(form, "user"),
+	}
+	if n := formValue(form, "n"); n != "" {
+		v, err := strconv.Atoi(n)
+		if err != nil {
+			return req, fmt.Errorf("'%v' is not of type 'integer' - 'n'", n)
+		}
+		req.N = &v
+	}
+	return req, nil
+}
+
+// saveFile saves the uploaded file of the form field to dir and returns its
+// path, or an empty path if the field has no file.
+func saveFile(form *multipart.Form, key, dir string) (string, error) {
+	files := form.File[key]
+	if len(files) == 0 {
+		return "", nil
+	}
+	src, err := files[0].Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	path := filepath.Join(dir, key+"-"+filepath.Base(files[0].Filename))
+	dst, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", err
+	}
+	return path, dst.Close()
+}
+
+// logError logs the cause of an error response whose message is not written.
+func logError(err error) {
+	slog.Default().LogAttrs(context.Background(), slog.LevelError, "openai server error", slog.String("error", err.Error()))
+}
+
+func invalidRequest(message string) *openai.APIError {
+	return &openai.APIError{
+		StatusCode: http.StatusBadRequest,
+		Type:       "invalid_request_error",
+		Message:    message,
+	}
+}
+
+func writeResult(w http.ResponseWriter, resp any, err error) {
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// WriteJSON writes v as a JSON response with the status code.
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// WriteError writes err as an OpenAI API error response. An *openai.APIError
+// is written with its status code, or 400 if it has none. Budget errors are
+// written as 429 insufficient_quota errors, unknown price errors as 400
+// errors, unsupported operation errors as 404 errors, blocked content errors
+// as 400 content_policy_violation errors, open circuit errors as 503 errors,
+// context deadline errors as 504 timeouts and other errors as 500 server
+// errors. The messages of open circuit, deadline and other errors may reveal
+// upstream URLs or local paths, so they are logged with slog.Default instead
+// of written, and the response has a generic message.
+func WriteError(w http.ResponseWriter, err error) {
+	var apiErr *openai.APIError
+	switch {
+	case errors.As(err, &apiErr):
+	case errors.Is(err, openai.ErrBudgetExceeded):
+		apiErr = &openai.APIError{StatusCode: http.StatusTooManyRequests, Type: "insufficient_quota", Code: "insufficient_quota", Message: err.Error()}
+	case errors.Is(err, openai.ErrUnknownPrice):
+		apiErr = &openai.APIError{StatusCode: http.StatusBadRequest, Type: "invalid_request_error", Message: err.Error()}
+	case errors.Is(err, openai.ErrUnsupportedOperation):
+		apiErr = &openai.APIError{StatusCode: http.StatusNotFound, Type: "invalid_request_error", Message: err.Error()}
+	case errors.Is(err, openai.ErrContentBlocked):
+		apiErr = &openai.APIError{StatusCode: http.StatusBadRequest, Type: "invalid_request_error", Code: "content_policy_violation", Message: err.Error()}
+	case errors.Is(err, openai.ErrCircuitOpen):
+		logError(err)
+		apiErr = &openai.APIError{StatusCode: http.StatusServiceUnavailable, Type: "server_error", Message: "The server is temporarily unavailable."}
+	case errors.Is(err, context.DeadlineExceeded):
+		logError(err)
+		apiErr = &openai.APIError{StatusCode: http.StatusGatewayTimeout, Type: "timeout", Message: "Request timed out."}
+	default:
+		logError(err)
+		apiErr = &openai.APIError{StatusCode: http.StatusInternalServerError, Type: "server_error", Message: "The server had an error while processing your request."}
+	}
+	status := apiErr.StatusCode
+	if status == 0 {
+		status = http.StatusBadRequest
+	}
+	WriteJSON(w, status, map[string]any{"error": apiErr})
+}
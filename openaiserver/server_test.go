@@ -0,0 +1,152 @@
+package openaiserver_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaiserver"
+	"github.com/noclue/openai/openaitest"
+)
+
+// errorResponse decodes the API error of the recorded response.
+func errorResponse(t *testing.T, rec *httptest.ResponseRecorder) openai.APIError {
+	t.Helper()
+	var body struct {
+		Error openai.APIError `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Expected JSON error response, got %#v", err)
+	}
+	return body.Error
+}
+
+func TestWriteError(t *testing.T) {
+	t.Parallel()
+	internal := errors.New("dial tcp 10.0.0.1:443: connect: connection refused")
+	tests := []struct {
+		name      string
+		err       error
+		status    int
+		errorType string
+		code      any
+		message   string
+	}{
+		{"api error", &openai.APIError{StatusCode: http.StatusTooManyRequests, Type: "requests", Message: "Rate limit reached"}, http.StatusTooManyRequests, "requests", nil, "Rate limit reached"},
+		{"api error without status", &openai.APIError{Type: "invalid_request_error", Message: "bad"}, http.StatusBadRequest, "invalid_request_error", nil, "bad"},
+		{"budget", &openai.BudgetExceededError{Budget: "daily", Unit: "usd"}, http.StatusTooManyRequests, "insufficient_quota", "insufficient_quota", ""},
+		{"unknown price", &openai.UnknownPriceError{Budget: "daily", Model: "davinci-004"}, http.StatusBadRequest, "invalid_request_error", nil, ""},
+		{"unsupported operation", fmt.Errorf("azure: %w", openai.ErrUnsupportedOperation), http.StatusNotFound, "invalid_request_error", nil, ""},
+		{"content blocked", &openai.ContentBlockedError{Operation: openai.OperationEdit, Stage: openai.GuardInput, Field: "input"}, http.StatusBadRequest, "invalid_request_error", "content_policy_violation", ""},
+		{"circuit open", &openai.CircuitOpenError{Endpoint: "https://upstream.internal/v1/edits", Until: time.Now()}, http.StatusServiceUnavailable, "server_error", nil, "The server is temporarily unavailable."},
+		{"deadline", fmt.Errorf("Post \"https://upstream.internal/v1/edits\": %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "timeout", nil, "Request timed out."},
+		{"other", fmt.Errorf("openai: %w", internal), http.StatusInternalServerError, "server_error", nil, "The server had an error while processing your request."},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rec := httptest.NewRecorder()
+			openaiserver.WriteError(rec, tt.err)
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected JSON content type, got %q", ct)
+			}
+			apiErr := errorResponse(t, rec)
+			if apiErr.Type != tt.errorType || apiErr.Code != tt.code {
+				t.Errorf("Expected type %q and code %v, got %#v", tt.errorType, tt.code, apiErr)
+			}
+			message := tt.message
+			if message == "" {
+				message = tt.err.Error()
+			}
+			if apiErr.Message != message {
+				t.Errorf("Expected message %q, got %q", message, apiErr.Message)
+			}
+			if strings.Contains(apiErr.Message, "upstream.internal") || strings.Contains(apiErr.Message, "10.0.0.1") {
+				t.Errorf("Expected internal details not to be written, got %q", apiErr.Message)
+			}
+		})
+	}
+}
+
+// multipartBody returns a multipart form with the fields and an image file
+// unless image is empty.
+func multipartBody(t *testing.T, fields map[string]string, image string) (*bytes.Buffer, string) {
+	t.Helper()
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+	}
+	if image != "" {
+		fw, err := mw.CreateFormFile("image", "image.png")
+		if err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+		fw.Write([]byte(image))
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	return body, mw.FormDataContentType()
+}
+
+func TestHandlerRequestErrors(t *testing.T) {
+	t.Parallel()
+	invalidN, formType := multipartBody(t, map[string]string{"n": "two"}, "png")
+	noImage, noImageType := multipartBody(t, map[string]string{"prompt": "A winter forest"}, "")
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+		message     string
+	}{
+		{"invalid json", http.MethodPost, openaiserver.CompletionsPath, "application/json", "{", http.StatusBadRequest, "We could not parse the JSON body of your request"},
+		{"wrong method", http.MethodGet, openaiserver.EditsPath, "", "", http.StatusMethodNotAllowed, "Invalid method for URL (GET /v1/edits)"},
+		{"models wrong method", http.MethodPost, openaiserver.ModelsPath, "", "", http.StatusMethodNotAllowed, "Invalid method for URL (POST /v1/models)"},
+		{"not multipart", http.MethodPost, openaiserver.ImageVariationsPath, "application/json", "{}", http.StatusBadRequest, "We could not parse the multipart form of your request"},
+		{"invalid n", http.MethodPost, openaiserver.ImageVariationsPath, formType, invalidN.String(), http.StatusBadRequest, "'two' is not of type 'integer' - 'n'"},
+		{"missing image", http.MethodPost, openaiserver.ImageEditsPath, noImageType, noImage.String(), http.StatusBadRequest, "image is a required property"},
+		{"unknown path", http.MethodPost, "/v1/engines", "application/json", "{}", http.StatusNotFound, "Invalid URL (POST /v1/engines)"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fake := openaitest.NewFake()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			openaiserver.NewHandler(fake).ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			apiErr := errorResponse(t, rec)
+			if apiErr.Type != "invalid_request_error" || !strings.HasPrefix(apiErr.Message, tt.message) {
+				t.Errorf("Expected invalid request error %q, got %#v", tt.message, apiErr)
+			}
+			if calls := fake.Calls(); len(calls) != 0 {
+				t.Errorf("Expected no backend calls, got %#v", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+// Package openaitest provides utilities for testing code that uses the OpenAI
+// API client.
+//
+// Fake is a programmable implementation of the openai.OpenAI interface for
+// unit tests. Server is an HTTP test server that speaks the OpenAI API wire
+// format for end-to-end tests of the HTTP stack of the client.
+package openaitest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/noclue/openai"
+)
+
+// Call is a recorded call of a Fake method.
+type Call struct {
+	// Operation is the name of the called method, e.g.
+	// openai.OperationCreateCompletion.
+	Operation string
+	// Request is the request value, e.g. openai.CompletionsRequest. It is nil
+	// for Models.
+	Request any
+	// Time is the time of the call.
+	Time time.Time
+}
+
+// HandlerFunc computes the response to a request of a Fake method. The
+// request is a value like openai.CompletionsRequest and the response a
+// pointer like *openai.CompletionsResponse.
+type HandlerFunc func(ctx context.Context, request any) (any, error)
+
+type result struct {
+	response any
+	err      error
+}
+
+// Fake is a programmable implementation of the openai.OpenAI interface. Each
+// call is recorded, unless recording is turned off, and answered with the first queued result of its
+// operation, if any, then with the handler of the operation, if any, and
+// otherwise with DefaultResponse. It is safe for concurrent use.
+type Fake struct {
+	mu       sync.Mutex
+	queued   map[string][]result
+	handlers map[string]HandlerFunc
+	latency  time.Duration
+	calls    []Call
+	// notRecording is true if calls are not recorded.
+	notRecording bool
+}
+
+var _ openai.OpenAI = (*Fake)(nil)
+
+// NewFake creates a fake that answers every call with DefaultResponse.
+func NewFake() *Fake {
+	return &Fake{
+		queued:   map[string][]result{},
+		handlers: map[string]HandlerFunc{},
+	}
+}
+
+// Respond queues a response to the next call of the operation. The response
+// must be a pointer to the response type of the operation, e.g.
+// *openai.CompletionsResponse.
+func (f *Fake) Respond(operation string, response any) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queued[operation] = append(f.queued[operation], result{response: response})
+	return f
+}
+
+// Fail queues an error for the next call of the operation. Use APIError to
+// create errors like the ones returned by the API.
+func (f *Fake) Fail(operation string, err error) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queued[operation] = append(f.queued[operation], result{err: err})
+	return f
+}
+
+// Handle sets the handler of the calls of the operation that have no queued
+// result.
+func (f *Fake) Handle(operation string, handler HandlerFunc) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[operation] = handler
+	return f
+}
+
+// SetLatency makes every call wait for d before it is answered. A call whose
+// context is done while waiting returns the context error.
+func (f *Fake) SetLatency(d time.Duration) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latency = d
+	return f
+}
+
+// SetRecording turns the recording of calls on or off. Long-running fakes,
+// like the one of a mock server, should turn it off, since recorded calls are
+// kept until Reset.
+func (f *Fake) SetRecording(record bool) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notRecording = !record
+	return f
+}
+
+// Calls returns the recorded calls of the operation, or of all operations if
+// no operation is given.
+func (f *Fake) Calls(operation ...string) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []Call
+	for _, call := range f.calls {
+		if len(operation) == 0 || call.Operation == operation[0] {
+			res = append(res, call)
+		}
+	}
+	return res
+}
+
+// Reset discards the recorded calls, queued results and handlers, and turns
+// recording back on.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+	f.notRecording = false
+	f.queued = map[string][]result{}
+	f.handlers = map[string]HandlerFunc{}
+	f.latency = 0
+}
+
+// AssertCalled reports a test error unless the operation was called exactly
+// times times.
+func (f *Fake) AssertCalled(t testing.TB, operation string, times int) bool {
+	t.Helper()
+	if n := len(f.Calls(operation)); n != times {
+		t.Errorf("openaitest: expected %v to be called %d times, got %d", operation, times, n)
+		return false
+	}
+	return true
+}
+
+// AssertNotCalled reports a test error if the operation was called.
+func (f *Fake) AssertNotCalled(t testing.TB, operation string) bool {
+	t.Helper()
+	return f.AssertCalled(t, operation, 0)
+}
+
+// LastRequest returns the request of the last call of the operation, or nil
+// if it was not called.
+func (f *Fake) LastRequest(operation string) any {
+	calls := f.Calls(operation)
+	if len(calls) == 0 {
+		return nil
+	}
+	return calls[len(calls)-1].Request
+}
+
+// call records the call and returns its result.
+func (f *Fake) call(ctx context.Context, operation string, request any) (any, error) {
+	f.mu.Lock()
+	if !f.notRecording {
+		f.calls = append(f.calls, Call{Operation: operation, Request: request, Time: time.Now()})
+	}
+	latency := f.latency
+	var next *result
+	if queued := f.queued[operation]; len(queued) > 0 {
+		next = &queued[0]
+		f.queued[operation] = queued[1:]
+	}
+	handler := f.handlers[operation]
+	f.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	switch {
+	case next != nil:
+		return next.response, next.err
+	case handler != nil:
+		return handler(ctx, request)
+	default:
+		return DefaultResponse(operation, request)
+	}
+}
+
+// respond returns the result of the call as the response type T.
+func respond[T any](f *Fake, ctx context.Context, operation string, request any) (*T, error) {
+	resp, err := f.call(ctx, operation, request)
+	if err != nil {
+		return nil, err
+	}
+	switch resp := resp.(type) {
+	case *T:
+		return resp, nil
+	case T:
+		return &resp, nil
+	default:
+		return nil, fmt.Errorf("openaitest: invalid %v response type %T, want %T", operation, resp, new(T))
+	}
+}
+
+// CreateImage records the call and returns its programmed result.
+func (f *Fake) CreateImage(ctx context.Context, req openai.CreateImageReq) (*openai.ImageResponse, error) {
+	return respond[openai.ImageResponse](f, ctx, openai.OperationCreateImage, req)
+}
+
+// CreateImageVariations records the call and returns its programmed result.
+func (f *Fake) CreateImageVariations(ctx context.Context, req openai.CreateImageVariationsReq) (*openai.ImageResponse, error) {
+	return respond[openai.ImageResponse](f, ctx, openai.OperationCreateImageVariations, req)
+}
+
+// CreateImageEdits records the call and returns its programmed result.
+func (f *Fake) CreateImageEdits(ctx context.Context, req openai.CreateImageEditsReq) (*openai.ImageResponse, error) {
+	return respond[openai.ImageResponse](f, ctx, openai.OperationCreateImageEdits, req)
+}
+
+// CreateCompletion records the call and returns its programmed result.
+func (f *Fake) CreateCompletion(ctx context.Context, req openai.CompletionsRequest) (*openai.CompletionsResponse, error) {
+	return respond[openai.CompletionsResponse](f, ctx, openai.OperationCreateCompletion, req)
+}
+
+// Edit records the call and returns its programmed result.
+func (f *Fake) Edit(ctx context.Context, req openai.EditRequest) (*openai.EditResponse, error) {
+	return respond[openai.EditResponse](f, ctx, openai.OperationEdit, req)
+}
+
+// Models records the call and returns its programmed result.
+func (f *Fake) Models(ctx context.Context) (*openai.ModelsResponse, error) {
+	return respond[openai.ModelsResponse](f, ctx, openai.OperationModels, nil)
+}
+
+// Moderation records the call and returns its programmed result.
+func (f *Fake) Moderation(ctx context.Context, req openai.ModerationRequest) (*openai.ModerationResponse, error) {
+	return respond[openai.ModerationResponse](f, ctx, openai.OperationModeration, req)
+}
+
+// APIError returns an error like the ones returned by the OpenAI API. Server
+// writes it with the status code.
+func APIError(status int, errType, message string) *openai.APIError {
+	return &openai.APIError{StatusCode: status, Type: errType, Message: message}
+}
@@ -0,0 +1,89 @@
+package openaitest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaitest"
+)
+
+func TestFake(t *testing.T) {
+	t.Parallel()
+	fake := openaitest.NewFake()
+	var client openai.OpenAI = fake
+
+	res, err := client.CreateCompletion(context.Background(), openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "Say this is a test"})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if res.Choices[0].Text != openaitest.CompletionText {
+		t.Errorf("Expected default completion, got %q", res.Choices[0].Text)
+	}
+
+	fake.Respond(openai.OperationCreateCompletion, &openai.CompletionsResponse{Choices: []openai.Choice{{Text: "scripted"}}}).
+		Fail(openai.OperationCreateCompletion, openaitest.APIError(http.StatusTooManyRequests, "rate_limit_exceeded", "slow down"))
+	res, err = client.CreateCompletion(context.Background(), openai.CompletionsRequest{Prompt: "second"})
+	if err != nil || res.Choices[0].Text != "scripted" {
+		t.Errorf("Expected scripted response, got %#v, %#v", res, err)
+	}
+	_, err = client.CreateCompletion(context.Background(), openai.CompletionsRequest{Prompt: "third"})
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected injected API error, got %#v", err)
+	}
+
+	fake.Handle(openai.OperationModeration, func(ctx context.Context, request any) (any, error) {
+		req := request.(openai.ModerationRequest)
+		return &openai.ModerationResponse{Results: []openai.ModerationResult{{Flagged: req.Input[0] == "bad"}}}, nil
+	})
+	mod, err := client.Moderation(context.Background(), openai.ModerationRequest{Input: []string{"bad"}})
+	if err != nil || !mod.Results[0].Flagged {
+		t.Errorf("Expected flagged result from handler, got %#v, %#v", mod, err)
+	}
+
+	fake.AssertCalled(t, openai.OperationCreateCompletion, 3)
+	fake.AssertCalled(t, openai.OperationModeration, 1)
+	fake.AssertNotCalled(t, openai.OperationEdit)
+	if req := fake.LastRequest(openai.OperationCreateCompletion).(openai.CompletionsRequest); req.Prompt != "third" {
+		t.Errorf("Expected last prompt 'third', got %q", req.Prompt)
+	}
+	if n := len(fake.Calls()); n != 4 {
+		t.Errorf("Expected 4 calls, got %d", n)
+	}
+}
+
+func TestFakeRecording(t *testing.T) {
+	t.Parallel()
+	fake := openaitest.NewFake().SetRecording(false)
+	if _, err := fake.Models(context.Background()); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	fake.AssertNotCalled(t, openai.OperationModels)
+	fake.SetRecording(true)
+	if _, err := fake.Models(context.Background()); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	fake.AssertCalled(t, openai.OperationModels, 1)
+}
+
+func TestFakeLatency(t *testing.T) {
+	t.Parallel()
+	fake := openaitest.NewFake().SetLatency(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := fake.Models(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %#v", err)
+	}
+}
+
+func TestFakeInvalidResponseType(t *testing.T) {
+	t.Parallel()
+	fake := openaitest.NewFake().Respond(openai.OperationEdit, &openai.CompletionsResponse{})
+	if _, err := fake.Edit(context.Background(), openai.EditRequest{}); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
@@ -0,0 +1,167 @@
+package openaitest
+
+import (
+	"fmt"
+
+	"github.com/noclue/openai"
+)
+
+// Created is the creation time of the default responses.
+const Created = 1672531200
+
+// CompletionText is the text of the choices of the default completions
+// response.
+const CompletionText = " This is a test completion."
+
+// Base64PNG is the base64 encoded 1x1 transparent PNG image of the default
+// images responses in the b64_json format.
+const Base64PNG = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="
+
+// Models are the IDs of the models of the default models response.
+var Models = []string{
+	"text-davinci-003",
+	"text-curie-001",
+	"text-babbage-001",
+	"text-ada-001",
+	"text-davinci-edit-001",
+	"text-moderation-latest",
+	"text-moderation-stable",
+}
+
+// DefaultResponse returns the deterministic response to a request of the
+// operation: completions of CompletionText, edits that return the input
+// unchanged, moderation results that flag nothing, images pointing to
+// example.com or encoded as Base64PNG, and a list of Models. The request is a
+// value like openai.CompletionsRequest, or nil for models. The response is a
+// pointer like *openai.CompletionsResponse.
+func DefaultResponse(operation string, request any) (any, error) {
+	switch operation {
+	case openai.OperationModels:
+		return defaultModels(), nil
+	case openai.OperationCreateCompletion:
+		req, ok := request.(openai.CompletionsRequest)
+		if !ok {
+			return nil, requestTypeError(operation, request)
+		}
+		return defaultCompletion(req), nil
+	case openai.OperationEdit:
+		req, ok := request.(openai.EditRequest)
+		if !ok {
+			return nil, requestTypeError(operation, request)
+		}
+		return defaultEdit(req), nil
+	case openai.OperationModeration:
+		req, ok := request.(openai.ModerationRequest)
+		if !ok {
+			return nil, requestTypeError(operation, request)
+		}
+		return defaultModeration(req), nil
+	case openai.OperationCreateImage:
+		req, ok := request.(openai.CreateImageReq)
+		if !ok {
+			return nil, requestTypeError(operation, request)
+		}
+		return defaultImages(req.CommonImageReq), nil
+	case openai.OperationCreateImageVariations:
+		req, ok := request.(openai.CreateImageVariationsReq)
+		if !ok {
+			return nil, requestTypeError(operation, request)
+		}
+		return defaultImages(req.CommonImageReq), nil
+	case openai.OperationCreateImageEdits:
+		req, ok := request.(openai.CreateImageEditsReq)
+		if !ok {
+			return nil, requestTypeError(operation, request)
+		}
+		return defaultImages(req.CommonImageReq), nil
+	default:
+		return nil, fmt.Errorf("openaitest: unknown operation %v", operation)
+	}
+}
+
+func requestTypeError(operation string, request any) error {
+	return fmt.Errorf("openaitest: invalid %v request type %T", operation, request)
+}
+
+// tokens returns the approximate number of tokens in s.
+func tokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+func count(n *int) int {
+	if n == nil || *n < 1 {
+		return 1
+	}
+	return *n
+}
+
+func defaultModels() *openai.ModelsResponse {
+	resp := &openai.ModelsResponse{Object: "list"}
+	for _, id := range Models {
+		resp.Data = append(resp.Data, openai.Model{
+			ID:      id,
+			Object:  "model",
+			Created: Created,
+			OwnedBy: "openai",
+			Root:    id,
+		})
+	}
+	return resp
+}
+
+func defaultCompletion(req openai.CompletionsRequest) *openai.CompletionsResponse {
+	n := count(req.N)
+	resp := &openai.CompletionsResponse{
+		Id:      "cmpl-openaitest",
+		Object:  "text_completion",
+		Created: Created,
+		Model:   req.Model,
+	}
+	for i := 0; i < n; i++ {
+		text := CompletionText
+		if req.Echo != nil && *req.Echo {
+			text = req.Prompt + text
+		}
+		resp.Choices = append(resp.Choices, openai.Choice{Text: text, Index: i, FinishReason: "stop"})
+	}
+	resp.Usage.PropmtTokens = tokens(req.Prompt)
+	resp.Usage.CompletionTokens = n * tokens(CompletionText)
+	resp.Usage.TotalTokens = resp.Usage.PropmtTokens + resp.Usage.CompletionTokens
+	return resp
+}
+
+func defaultEdit(req openai.EditRequest) *openai.EditResponse {
+	n := count(req.N)
+	resp := &openai.EditResponse{Object: "edit", Created: Created}
+	for i := 0; i < n; i++ {
+		resp.Choices = append(resp.Choices, openai.EditChoice{Text: req.Input, Index: i})
+	}
+	resp.Usage.PropmtTokens = tokens(req.Input) + tokens(req.Instruction)
+	resp.Usage.CompletionTokens = n * tokens(req.Input)
+	resp.Usage.TotalTokens = resp.Usage.PropmtTokens + resp.Usage.CompletionTokens
+	return resp
+}
+
+func defaultModeration(req openai.ModerationRequest) *openai.ModerationResponse {
+	model := req.Model
+	if model == "" {
+		model = "text-moderation-latest"
+	}
+	resp := &openai.ModerationResponse{ID: "modr-openaitest", Model: model}
+	for range req.Input {
+		resp.Results = append(resp.Results, openai.ModerationResult{})
+	}
+	return resp
+}
+
+func defaultImages(req openai.CommonImageReq) *openai.ImageResponse {
+	resp := &openai.ImageResponse{Created: Created}
+	for i := 0; i < count(req.N); i++ {
+		if req.ResponseFormat == openai.B64_json {
+			resp.Data = append(resp.Data, openai.ImageData{B64JSON: Base64PNG})
+		} else {
+			resp.Data = append(resp.Data, openai.ImageData{URL: fmt.Sprintf("https://example.com/images/%d.png", i)})
+		}
+	}
+	return resp
+}
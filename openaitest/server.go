@@ -0,0 +1,54 @@
+package openaitest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaiserver"
+)
+
+// Server is an HTTP test server that speaks the OpenAI API wire format. It
+// decodes requests, answers them with its Fake and encodes the responses and
+// errors like the OpenAI API. Requests without a bearer token are rejected
+// with 401.
+type Server struct {
+	*httptest.Server
+	// Fake answers the requests to the server.
+	Fake *Fake
+}
+
+// NewServer starts a server answering with fake, or with a new Fake if fake
+// is nil. The caller must close the server when done.
+func NewServer(fake *Fake) *Server {
+	if fake == nil {
+		fake = NewFake()
+	}
+	handler := openaiserver.NewHandler(fake)
+	return &Server{
+		Server: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				openaiserver.WriteError(w, &openai.APIError{
+					StatusCode: http.StatusUnauthorized,
+					Type:       "invalid_request_error",
+					Message:    "You didn't provide an API key.",
+				})
+				return
+			}
+			handler.ServeHTTP(w, r)
+		})),
+		Fake: fake,
+	}
+}
+
+// OpenAI returns a client of the server with the API key "sk-openaitest".
+// The options are applied after the base URL and HTTP client are set.
+func (s *Server) OpenAI(options ...openai.Option) openai.OpenAI {
+	all := []openai.Option{
+		openai.WithBaseURL(s.URL),
+		openai.WithHttpClient(s.Client()),
+	}
+	return openai.NewOpenAI("sk-openaitest", append(all, options...)...)
+}
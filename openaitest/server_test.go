@@ -0,0 +1,87 @@
+package openaitest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaitest"
+)
+
+// TestServer tests every client method end to end against the server.
+func TestServer(t *testing.T) {
+	t.Parallel()
+	server := openaitest.NewServer(nil)
+	defer server.Close()
+	client := server.OpenAI()
+	ctx := context.Background()
+	n := 2
+
+	models, err := client.Models(ctx)
+	if err != nil || len(models.Data) != len(openaitest.Models) {
+		t.Errorf("Expected default models, got %#v, %#v", models, err)
+	}
+	completion, err := client.CreateCompletion(ctx, openai.CompletionsRequest{Model: "text-davinci-003", Prompt: "Say this is a test", N: &n})
+	if err != nil || len(completion.Choices) != 2 || completion.Usage.TotalTokens == 0 {
+		t.Errorf("Expected 2 completions with usage, got %#v, %#v", completion, err)
+	}
+	edit, err := client.Edit(ctx, openai.EditRequest{Model: "text-davinci-edit-001", Input: "blah-blah", Instruction: "keep"})
+	if err != nil || edit.Choices[0].Text != "blah-blah" {
+		t.Errorf("Expected unchanged input, got %#v, %#v", edit, err)
+	}
+	moderation, err := client.Moderation(ctx, openai.ModerationRequest{Input: []string{"a", "b"}})
+	if err != nil || len(moderation.Results) != 2 || moderation.Results[0].Flagged {
+		t.Errorf("Expected 2 unflagged results, got %#v, %#v", moderation, err)
+	}
+	image, err := client.CreateImage(ctx, openai.CreateImageReq{Prompt: "This is a test", CommonImageReq: openai.CommonImageReq{N: &n, ResponseFormat: openai.B64_json}})
+	if err != nil || len(image.Data) != 2 || image.Data[0].B64JSON != openaitest.Base64PNG {
+		t.Errorf("Expected 2 base64 images, got %#v, %#v", image, err)
+	}
+	imagePath := filepath.Join("..", "testdata", "image.png")
+	variations, err := client.CreateImageVariations(ctx, openai.CreateImageVariationsReq{Image: imagePath, CommonImageReq: openai.CommonImageReq{N: &n, Size: openai.SmallImage}})
+	if err != nil || len(variations.Data) != 2 {
+		t.Errorf("Expected 2 variations, got %#v, %#v", variations, err)
+	}
+	edits, err := client.CreateImageEdits(ctx, openai.CreateImageEditsReq{Image: imagePath, Mask: filepath.Join("..", "testdata", "mask.png"), Prompt: "A winter forest"})
+	if err != nil || len(edits.Data) != 1 {
+		t.Errorf("Expected 1 image edit, got %#v, %#v", edits, err)
+	}
+
+	req := server.Fake.LastRequest(openai.OperationCreateImageVariations).(openai.CreateImageVariationsReq)
+	if *req.N != 2 || req.Size != openai.SmallImage || filepath.Base(req.Image) != "image-image.png" {
+		t.Errorf("Expected decoded multipart request, got %#v", req)
+	}
+	editReq := server.Fake.LastRequest(openai.OperationCreateImageEdits).(openai.CreateImageEditsReq)
+	if editReq.Prompt != "A winter forest" || editReq.Mask == "" {
+		t.Errorf("Expected decoded multipart request with mask, got %#v", editReq)
+	}
+	if n := len(server.Fake.Calls()); n != 7 {
+		t.Errorf("Expected 7 calls, got %d", n)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	t.Parallel()
+	server := openaitest.NewServer(nil)
+	defer server.Close()
+	server.Fake.Fail(openai.OperationEdit, openaitest.APIError(http.StatusServiceUnavailable, "server_error", "The server is overloaded"))
+
+	_, err := server.OpenAI().Edit(context.Background(), openai.EditRequest{Input: "blah-blah"})
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected APIError, got %#v", err)
+	}
+	if apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Message != "The server is overloaded" {
+		t.Errorf("Expected 503 overloaded error, got %#v", apiErr)
+	}
+
+	unauthorized := openai.NewOpenAI("", openai.WithBaseURL(server.URL))
+	_, err = unauthorized.Models(context.Background())
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 error, got %#v", err)
+	}
+	server.Fake.AssertNotCalled(t, openai.OperationModels)
+}
@@ -0,0 +1,58 @@
+package openaitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"github.com/noclue/openai"
+)
+
+// templateFuncs are the functions available to response templates.
+var templateFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. to quote strings from the request.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// TemplateHandler returns a handler that answers calls of the operation with
+// the JSON response rendered from the text/template tmpl. The template is
+// executed with the request value, so {{json .Prompt}} inserts the quoted
+// prompt of a completions request. The rendered JSON is decoded into the
+// response type of the operation.
+func TemplateHandler(operation, tmpl string) (HandlerFunc, error) {
+	newResponse, ok := responseTypes[operation]
+	if !ok {
+		return nil, fmt.Errorf("openaitest: unknown operation %v", operation)
+	}
+	t, err := template.New(operation).Funcs(templateFuncs).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("openaitest: %v response template parsing error: %w", operation, err)
+	}
+	return func(ctx context.Context, request any) (any, error) {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, request); err != nil {
+			return nil, fmt.Errorf("openaitest: %v response template execution error: %w", operation, err)
+		}
+		resp := newResponse()
+		if err := json.Unmarshal(buf.Bytes(), resp); err != nil {
+			return nil, fmt.Errorf("openaitest: %v response template JSON decoding error: %w", operation, err)
+		}
+		return resp, nil
+	}, nil
+}
+
+// responseTypes maps the operations to constructors of their responses.
+var responseTypes = map[string]func() any{
+	openai.OperationModels:                func() any { return &openai.ModelsResponse{} },
+	openai.OperationCreateCompletion:      func() any { return &openai.CompletionsResponse{} },
+	openai.OperationEdit:                  func() any { return &openai.EditResponse{} },
+	openai.OperationModeration:            func() any { return &openai.ModerationResponse{} },
+	openai.OperationCreateImage:           func() any { return &openai.ImageResponse{} },
+	openai.OperationCreateImageVariations: func() any { return &openai.ImageResponse{} },
+	openai.OperationCreateImageEdits:      func() any { return &openai.ImageResponse{} },
+}
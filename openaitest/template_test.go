@@ -0,0 +1,37 @@
+package openaitest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaitest"
+)
+
+func TestTemplateHandler(t *testing.T) {
+	t.Parallel()
+	handler, err := openaitest.TemplateHandler(openai.OperationCreateCompletion,
+		`{"model": {{json .Model}}, "choices": [{"text": {{json (printf "echo: %s" .Prompt)}}, "index": 0, "finish_reason": "stop"}]}`)
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	fake := openaitest.NewFake().Handle(openai.OperationCreateCompletion, handler)
+	res, err := fake.CreateCompletion(context.Background(), openai.CompletionsRequest{Model: "text-davinci-003", Prompt: `say "hi"`})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if res.Model != "text-davinci-003" || res.Choices[0].Text != `echo: say "hi"` {
+		t.Errorf("Expected rendered response, got %#v", res)
+	}
+
+	if _, err := openaitest.TemplateHandler("Unknown", "{}"); err == nil {
+		t.Error("Expected error for unknown operation, got nil")
+	}
+	invalid, err := openaitest.TemplateHandler(openai.OperationEdit, "not json")
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if _, err := invalid(context.Background(), openai.EditRequest{}); err == nil {
+		t.Error("Expected error for invalid JSON, got nil")
+	}
+}
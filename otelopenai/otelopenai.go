@@ -0,0 +1,314 @@
+// Package otelopenai instruments the OpenAI API client with OpenTelemetry.
+//
+// Middleware creates a span for every call of an OpenAI interface method with
+// the attributes of the OpenTelemetry semantic conventions for generative AI
+// and records latency, error and token usage metrics. HttpClient propagates the
+// trace context of the calls to the OpenAI API:
+//
+//	client := openai.NewOpenAI(apiKey,
+//		openai.WithMiddleware(otelopenai.Middleware()),
+//		openai.WithHttpClient(otelopenai.HttpClient(http.DefaultClient)))
+package otelopenai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/noclue/openai"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer and meter.
+const instrumentationName = "github.com/noclue/openai/otelopenai"
+
+// Attribute keys of the OpenTelemetry semantic conventions for generative AI
+// and the OpenAI specific attributes recorded on spans.
+const (
+	AttrSystem               = attribute.Key("gen_ai.system")
+	AttrOperationName        = attribute.Key("gen_ai.operation.name")
+	AttrRequestModel         = attribute.Key("gen_ai.request.model")
+	AttrRequestMaxTokens     = attribute.Key("gen_ai.request.max_tokens")
+	AttrRequestTemperature   = attribute.Key("gen_ai.request.temperature")
+	AttrRequestTopP          = attribute.Key("gen_ai.request.top_p")
+	AttrResponseID           = attribute.Key("gen_ai.response.id")
+	AttrResponseModel        = attribute.Key("gen_ai.response.model")
+	AttrResponseFinishReason = attribute.Key("gen_ai.response.finish_reasons")
+	AttrUsageInputTokens     = attribute.Key("gen_ai.usage.input_tokens")
+	AttrUsageOutputTokens    = attribute.Key("gen_ai.usage.output_tokens")
+	AttrTokenType            = attribute.Key("gen_ai.token.type")
+	AttrErrorType            = attribute.Key("error.type")
+	AttrHTTPStatusCode       = attribute.Key("http.response.status_code")
+	AttrImageCount           = attribute.Key("openai.image.count")
+	AttrRequestID            = attribute.Key("openai.request.id")
+)
+
+// operationNames maps the OpenAI interface methods to gen_ai.operation.name
+// values.
+var operationNames = map[string]string{
+	openai.OperationCreateCompletion:      "text_completion",
+	openai.OperationEdit:                  "edit",
+	openai.OperationCreateImage:           "image_generation",
+	openai.OperationCreateImageVariations: "image_variation",
+	openai.OperationCreateImageEdits:      "image_edit",
+	openai.OperationModels:                "list_models",
+	openai.OperationModeration:            "moderation",
+}
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	propagator     propagation.TextMapPropagator
+}
+
+// Option configures the instrumentation.
+type Option func(*config)
+
+// WithTracerProvider sets the tracer provider. The global tracer provider is
+// used by default.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = provider
+	}
+}
+
+// WithMeterProvider sets the meter provider. The global meter provider is used
+// by default.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(c *config) {
+		c.meterProvider = provider
+	}
+}
+
+// WithPropagator sets the propagator used by HttpClient. The global text map
+// propagator is used by default.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagator = propagator
+	}
+}
+
+func newConfig(options []Option) *config {
+	c := &config{
+		tracerProvider: otel.GetTracerProvider(),
+		meterProvider:  otel.GetMeterProvider(),
+		propagator:     otel.GetTextMapPropagator(),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+type instruments struct {
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+	tokens   metric.Int64Histogram
+	errors   metric.Int64Counter
+}
+
+// Middleware returns middleware that traces calls and records their metrics.
+// Instruments that cannot be created are reported to the global OpenTelemetry
+// error handler and replaced by no-op instruments.
+func Middleware(options ...Option) openai.Middleware {
+	c := newConfig(options)
+	meter := c.meterProvider.Meter(instrumentationName)
+	var (
+		inst = instruments{tracer: c.tracerProvider.Tracer(instrumentationName)}
+		err  error
+	)
+	inst.duration, err = meter.Float64Histogram("gen_ai.client.operation.duration",
+		metric.WithDescription("Duration of OpenAI API calls"),
+		metric.WithUnit("s"))
+	if err != nil {
+		otel.Handle(err)
+		inst.duration = noop.Float64Histogram{}
+	}
+	inst.tokens, err = meter.Int64Histogram("gen_ai.client.token.usage",
+		metric.WithDescription("Number of input and output tokens used by OpenAI API calls"),
+		metric.WithUnit("{token}"))
+	if err != nil {
+		otel.Handle(err)
+		inst.tokens = noop.Int64Histogram{}
+	}
+	inst.errors, err = meter.Int64Counter("openai.client.errors",
+		metric.WithDescription("Number of failed OpenAI API calls"),
+		metric.WithUnit("{error}"))
+	if err != nil {
+		otel.Handle(err)
+		inst.errors = noop.Int64Counter{}
+	}
+	return func(next openai.Handler) openai.Handler {
+		return func(ctx context.Context, call *openai.Call) error {
+			return inst.handle(ctx, call, next)
+		}
+	}
+}
+
+func (inst *instruments) handle(ctx context.Context, call *openai.Call, next openai.Handler) error {
+	operation := operationNames[call.Operation]
+	if operation == "" {
+		operation = call.Operation
+	}
+	model := call.Model()
+	name := operation
+	if model != "" {
+		name += " " + model
+	}
+	common := []attribute.KeyValue{
+		AttrSystem.String("openai"),
+		AttrOperationName.String(operation),
+	}
+	if model != "" {
+		common = append(common, AttrRequestModel.String(model))
+	}
+	ctx, span := inst.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(common...),
+		trace.WithAttributes(requestAttributes(call)...))
+	defer span.End()
+
+	start := time.Now()
+	err := next(ctx, call)
+	elapsed := time.Since(start).Seconds()
+
+	if call.StatusCode != 0 {
+		span.SetAttributes(AttrHTTPStatusCode.Int(call.StatusCode))
+	}
+	if call.RequestID != "" {
+		span.SetAttributes(AttrRequestID.String(call.RequestID))
+	}
+	metricAttrs := common
+	if err != nil {
+		errorType := errorType(err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(AttrErrorType.String(errorType))
+		metricAttrs = append(metricAttrs, AttrErrorType.String(errorType))
+		inst.errors.Add(ctx, 1, metric.WithAttributes(metricAttrs...))
+		inst.duration.Record(ctx, elapsed, metric.WithAttributes(metricAttrs...))
+		return err
+	}
+
+	resp := responseAttributes(call)
+	span.SetAttributes(resp.attrs...)
+	if resp.model != "" {
+		metricAttrs = append(metricAttrs, AttrResponseModel.String(resp.model))
+	}
+	inst.duration.Record(ctx, elapsed, metric.WithAttributes(metricAttrs...))
+	if resp.usage != nil {
+		inst.tokens.Record(ctx, int64(resp.usage.PropmtTokens),
+			metric.WithAttributes(append(metricAttrs, AttrTokenType.String("input"))...))
+		inst.tokens.Record(ctx, int64(resp.usage.CompletionTokens),
+			metric.WithAttributes(append(metricAttrs, AttrTokenType.String("output"))...))
+	}
+	return nil
+}
+
+// requestAttributes returns the span attributes of the request parameters.
+func requestAttributes(call *openai.Call) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	switch req := call.Request.(type) {
+	case *openai.CompletionsRequest:
+		if req.MaxTokens != nil {
+			attrs = append(attrs, AttrRequestMaxTokens.Int(*req.MaxTokens))
+		}
+		if req.Temperature != nil {
+			attrs = append(attrs, AttrRequestTemperature.Float64(*req.Temperature))
+		}
+		if req.TopP != nil {
+			attrs = append(attrs, AttrRequestTopP.Float64(*req.TopP))
+		}
+	case *openai.EditRequest:
+		if req.Temperature != nil {
+			attrs = append(attrs, AttrRequestTemperature.Float64(*req.Temperature))
+		}
+		if req.TopP != nil {
+			attrs = append(attrs, AttrRequestTopP.Float64(*req.TopP))
+		}
+	}
+	return attrs
+}
+
+type responseInfo struct {
+	attrs []attribute.KeyValue
+	model string
+	usage *openai.Usage
+}
+
+// responseAttributes returns the span attributes, model and token usage of a
+// successful call.
+func responseAttributes(call *openai.Call) responseInfo {
+	var info responseInfo
+	switch resp := call.Response.(type) {
+	case *openai.CompletionsResponse:
+		info.model = resp.Model
+		info.usage = &resp.Usage
+		reasons := make([]string, 0, len(resp.Choices))
+		for _, choice := range resp.Choices {
+			reasons = append(reasons, choice.FinishReason)
+		}
+		info.attrs = append(info.attrs,
+			AttrResponseID.String(resp.Id),
+			AttrResponseFinishReason.StringSlice(reasons))
+	case *openai.EditResponse:
+		info.usage = &resp.Usage
+	case *openai.ModerationResponse:
+		info.model = resp.Model
+		info.attrs = append(info.attrs, AttrResponseID.String(resp.ID))
+	case *openai.ImageResponse:
+		info.attrs = append(info.attrs, AttrImageCount.Int(len(resp.Data)))
+	}
+	if info.model != "" {
+		info.attrs = append(info.attrs, AttrResponseModel.String(info.model))
+	}
+	if info.usage != nil {
+		info.attrs = append(info.attrs,
+			AttrUsageInputTokens.Int(info.usage.PropmtTokens),
+			AttrUsageOutputTokens.Int(info.usage.CompletionTokens))
+	}
+	return info
+}
+
+// errorType returns the error.type attribute value of a failed call: the
+// OpenAI error type or the HTTP status code of API errors, or the Go type of
+// the innermost wrapped error.
+func errorType(err error) string {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Type != "" {
+			return apiErr.Type
+		}
+		return strconv.Itoa(apiErr.StatusCode)
+	}
+	for inner := errors.Unwrap(err); inner != nil; inner = errors.Unwrap(inner) {
+		err = inner
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+type httpClient struct {
+	next       openai.HttpClient
+	propagator propagation.TextMapPropagator
+}
+
+// HttpClient returns an HTTP client that injects the trace context of the
+// request context into the headers of requests made with next.
+func HttpClient(next openai.HttpClient, options ...Option) openai.HttpClient {
+	return &httpClient{next: next, propagator: newConfig(options).propagator}
+}
+
+// Do injects the trace context and sends the request with the wrapped client.
+func (c *httpClient) Do(req *http.Request) (*http.Response, error) {
+	c.propagator.Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	return c.next.Do(req)
+}
@@ -0,0 +1,208 @@
+package otelopenai_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/otelopenai"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	apiKey = "sk-12345"
+
+	completionsResponse = `{
+		"id": "cmpl-1",
+		"object": "text_completion",
+		"created": 1632632576,
+		"model": "text-davinci-003",
+		"choices": [{"text": "blah-blah", "index": 0, "finish_reason": "stop"}],
+		"usage": {"prompt_tokens": 5, "completion_tokens": 7, "total_tokens": 12}
+	}`
+	errInvalidToken = `{
+		"error": {
+			"code": "invalid_api_key",
+			"message": "Incorrect API key provided...",
+			"param": null,
+			"type": "invalid_request_error"
+		}
+	}`
+)
+
+type mockHttpClient struct {
+	status int
+	body   string
+	header http.Header
+}
+
+func (m *mockHttpClient) Do(req *http.Request) (*http.Response, error) {
+	m.header = req.Header.Clone()
+	return &http.Response{
+		StatusCode: m.status,
+		Body:       io.NopCloser(strings.NewReader(m.body)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+	}, nil
+}
+
+func setup(status int, body string) (openai.OpenAI, *tracetest.SpanRecorder, *sdkmetric.ManualReader, *mockHttpClient) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	mock := &mockHttpClient{status: status, body: body}
+	client := openai.NewOpenAI(apiKey,
+		openai.WithMiddleware(otelopenai.Middleware(
+			otelopenai.WithTracerProvider(tp),
+			otelopenai.WithMeterProvider(mp))),
+		openai.WithHttpClient(otelopenai.HttpClient(mock,
+			otelopenai.WithPropagator(propagation.TraceContext{}))))
+	return client, recorder, reader, mock
+}
+
+func attrs(kvs []attribute.KeyValue) map[attribute.Key]attribute.Value {
+	res := map[attribute.Key]attribute.Value{}
+	for _, kv := range kvs {
+		res[kv.Key] = kv.Value
+	}
+	return res
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+	client, recorder, reader, mock := setup(http.StatusOK, completionsResponse)
+	maxTokens := 20
+	if _, err := client.CreateCompletion(context.Background(), openai.CompletionsRequest{
+		Model:     "text-davinci-003",
+		Prompt:    "blah-blah",
+		MaxTokens: &maxTokens,
+	}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "text_completion text-davinci-003" {
+		t.Errorf("Expected span name 'text_completion text-davinci-003', got %s", span.Name())
+	}
+	got := attrs(span.Attributes())
+	want := map[attribute.Key]attribute.Value{
+		otelopenai.AttrSystem:            attribute.StringValue("openai"),
+		otelopenai.AttrOperationName:     attribute.StringValue("text_completion"),
+		otelopenai.AttrRequestModel:      attribute.StringValue("text-davinci-003"),
+		otelopenai.AttrRequestMaxTokens:  attribute.IntValue(20),
+		otelopenai.AttrResponseModel:     attribute.StringValue("text-davinci-003"),
+		otelopenai.AttrResponseID:        attribute.StringValue("cmpl-1"),
+		otelopenai.AttrUsageInputTokens:  attribute.IntValue(5),
+		otelopenai.AttrUsageOutputTokens: attribute.IntValue(7),
+		otelopenai.AttrHTTPStatusCode:    attribute.IntValue(http.StatusOK),
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Expected %s=%v, got %v", k, v.Emit(), got[k].Emit())
+		}
+	}
+	if reasons := got[otelopenai.AttrResponseFinishReason].AsStringSlice(); len(reasons) != 1 || reasons[0] != "stop" {
+		t.Errorf("Expected finish reasons [stop], got %v", reasons)
+	}
+
+	traceparent := mock.header.Get("traceparent")
+	if !strings.Contains(traceparent, span.SpanContext().TraceID().String()) {
+		t.Errorf("Expected traceparent with trace ID %s, got %q", span.SpanContext().TraceID(), traceparent)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	metrics := map[string]metricdata.Metrics{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	duration, ok := metrics["gen_ai.client.operation.duration"].Data.(metricdata.Histogram[float64])
+	if !ok || len(duration.DataPoints) != 1 || duration.DataPoints[0].Count != 1 {
+		t.Errorf("Expected one duration measurement, got %#v", metrics["gen_ai.client.operation.duration"].Data)
+	}
+	tokens, ok := metrics["gen_ai.client.token.usage"].Data.(metricdata.Histogram[int64])
+	if !ok || len(tokens.DataPoints) != 2 {
+		t.Fatalf("Expected input and output token measurements, got %#v", metrics["gen_ai.client.token.usage"].Data)
+	}
+	var sum int64
+	for _, dp := range tokens.DataPoints {
+		sum += dp.Sum
+	}
+	if sum != 12 {
+		t.Errorf("Expected 12 tokens, got %d", sum)
+	}
+}
+
+func TestMiddlewareError(t *testing.T) {
+	t.Parallel()
+	client, recorder, reader, _ := setup(http.StatusUnauthorized, errInvalidToken)
+	if _, err := client.CreateImage(context.Background(), openai.CreateImageReq{Prompt: "This is a test"}); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Errorf("Expected error status, got %v", spans[0].Status())
+	}
+	if got := attrs(spans[0].Attributes())[otelopenai.AttrErrorType].AsString(); got != "invalid_request_error" {
+		t.Errorf("Expected error type invalid_request_error, got %s", got)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	found := false
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "openai.client.errors" {
+				continue
+			}
+			sum := m.Data.(metricdata.Sum[int64])
+			found = len(sum.DataPoints) == 1 && sum.DataPoints[0].Value == 1
+		}
+	}
+	if !found {
+		t.Error("Expected one error to be counted")
+	}
+}
+
+func TestMiddlewareErrorType(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		status int
+		body   string
+		want   string
+	}{
+		{http.StatusBadGateway, `{"error": {"message": "Bad gateway"}}`, "502"},
+		{http.StatusOK, `{"data": [`, "*json.SyntaxError"},
+	} {
+		client, recorder, _, _ := setup(tt.status, tt.body)
+		if _, err := client.Models(context.Background()); err == nil {
+			t.Fatal("Expected error, got nil")
+		}
+		spans := recorder.Ended()
+		if got := attrs(spans[0].Attributes())[otelopenai.AttrErrorType].AsString(); got != tt.want {
+			t.Errorf("Expected error type %v, got %s", tt.want, got)
+		}
+	}
+}
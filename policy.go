@@ -0,0 +1,205 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// ModerationAction is the action a moderation policy takes on a text.
+type ModerationAction string
+
+const (
+	// ActionAllow allows the text.
+	ActionAllow ModerationAction = "allow"
+	// ActionWarn allows the text with a warning.
+	ActionWarn ModerationAction = "warn"
+	// ActionBlock blocks the text.
+	ActionBlock ModerationAction = "block"
+)
+
+// severity orders the actions from allow to block.
+func (a ModerationAction) severity() int {
+	switch a {
+	case ActionWarn:
+		return 1
+	case ActionBlock:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// CategoryThresholds are the category scores from which a moderation policy
+// warns about or blocks a text. Zero thresholds are disabled.
+type CategoryThresholds struct {
+	Warn  float64 `json:"warn,omitempty" yaml:"warn,omitempty"`
+	Block float64 `json:"block,omitempty" yaml:"block,omitempty"`
+}
+
+// ModerationPolicy decides on texts from their moderation results.
+type ModerationPolicy struct {
+	// Categories are the thresholds per category name, e.g. "harassment".
+	// The names must be among Categories().
+	Categories map[string]CategoryThresholds `json:"categories,omitempty" yaml:"categories,omitempty"`
+	// Default are the thresholds of the categories without thresholds of
+	// their own, including categories unknown to this package.
+	Default CategoryThresholds `json:"default,omitempty" yaml:"default,omitempty"`
+	// Flagged is the action taken on texts the API flags. If it is empty, the
+	// Flagged field of results is ignored.
+	Flagged ModerationAction `json:"flagged,omitempty" yaml:"flagged,omitempty"`
+	// Allowlist are regular expressions of texts that are always allowed. A
+	// text is allowed only if an expression matches all of it, so "quote:.*"
+	// allows any text starting with "quote:" but "quote:" only that text.
+	Allowlist []string `json:"allowlist,omitempty" yaml:"allowlist,omitempty"`
+}
+
+// ModerationReason is a reason for the action of a ModerationDecision.
+type ModerationReason struct {
+	// Action is the action the reason calls for.
+	Action ModerationAction `json:"action" yaml:"action"`
+	// Category is the category whose score reached the threshold, or empty
+	// for reasons that are not about a category score.
+	Category string `json:"category,omitempty" yaml:"category,omitempty"`
+	// Score is the score of the category.
+	Score float64 `json:"score,omitempty" yaml:"score,omitempty"`
+	// Threshold is the threshold the score reached.
+	Threshold float64 `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+	// Pattern is the allowlist pattern the text matched.
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	// Flagged is true if the reason is that the API flagged the text.
+	Flagged bool `json:"flagged,omitempty" yaml:"flagged,omitempty"`
+}
+
+// String describes the reason.
+func (r ModerationReason) String() string {
+	switch {
+	case r.Pattern != "":
+		return fmt.Sprintf("%v: text matches allowlist pattern %q", r.Action, r.Pattern)
+	case r.Flagged:
+		return fmt.Sprintf("%v: text flagged by the moderation API", r.Action)
+	default:
+		return fmt.Sprintf("%v: %v score %.4f reached threshold %.4f", r.Action, r.Category, r.Score, r.Threshold)
+	}
+}
+
+// ModerationDecision is the decision of a moderation policy on a text.
+type ModerationDecision struct {
+	// Action is the most severe action of the reasons, or ActionAllow if
+	// there are none.
+	Action ModerationAction `json:"action" yaml:"action"`
+	// Reasons are the reasons for the action.
+	Reasons []ModerationReason `json:"reasons,omitempty" yaml:"reasons,omitempty"`
+	// Result is the moderation result the decision is based on.
+	Result ModerationResult `json:"result" yaml:"result"`
+}
+
+// ModerationEngine moderates texts and decides on them with a policy.
+type ModerationEngine struct {
+	client    OpenAI
+	policy    ModerationPolicy
+	allowlist []*regexp.Regexp
+}
+
+// NewModerationEngine creates an engine moderating texts with client and
+// deciding on them with policy. Thresholds must be between 0 and 1, the
+// categories must be known and the allowlist must hold valid regular
+// expressions.
+func NewModerationEngine(client OpenAI, policy ModerationPolicy) (*ModerationEngine, error) {
+	e := &ModerationEngine{client: client, policy: policy}
+	if err := policy.Default.validate("default"); err != nil {
+		return nil, err
+	}
+	for category, t := range policy.Categories {
+		if !slices.Contains(categoryOrder[:], category) {
+			return nil, fmt.Errorf("openai: unknown moderation policy category: %v", category)
+		}
+		if err := t.validate(category); err != nil {
+			return nil, err
+		}
+	}
+	switch policy.Flagged {
+	case "", ActionAllow, ActionWarn, ActionBlock:
+	default:
+		return nil, fmt.Errorf("openai: invalid moderation policy action for flagged texts: %v", policy.Flagged)
+	}
+	for _, pattern := range policy.Allowlist {
+		re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("openai: invalid moderation policy allowlist pattern: %w", err)
+		}
+		e.allowlist = append(e.allowlist, re)
+	}
+	return e, nil
+}
+
+// validate checks that the thresholds of the category are between 0 and 1.
+func (t CategoryThresholds) validate(category string) error {
+	if t.Warn < 0 || t.Warn > 1 || t.Block < 0 || t.Block > 1 {
+		return fmt.Errorf("openai: moderation policy thresholds of %v must be between 0 and 1", category)
+	}
+	return nil
+}
+
+// Moderate moderates the inputs of the request and returns the decisions on
+// them in the order of the inputs.
+func (e *ModerationEngine) Moderate(ctx context.Context, req ModerationRequest) ([]ModerationDecision, error) {
+	return e.moderate(ctx, e.client, req)
+}
+
+// moderate moderates the inputs of the request with client and returns the
+// decisions on them.
+func (e *ModerationEngine) moderate(ctx context.Context, client OpenAI, req ModerationRequest) ([]ModerationDecision, error) {
+	resp, err := client.Moderation(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Results) != len(req.Input) {
+		return nil, fmt.Errorf("openai: got %d moderation results for %d inputs", len(resp.Results), len(req.Input))
+	}
+	decisions := make([]ModerationDecision, len(req.Input))
+	for i, input := range req.Input {
+		decisions[i] = e.Evaluate(input, resp.Results[i])
+	}
+	return decisions, nil
+}
+
+// Evaluate decides on the input text from its moderation result. Allowlisted
+// texts are allowed. Otherwise every category whose score reaches a threshold
+// and the API's flag, if the policy acts on it, is a reason for the decision.
+func (e *ModerationEngine) Evaluate(input string, result ModerationResult) ModerationDecision {
+	decision := ModerationDecision{Action: ActionAllow, Result: result}
+	for i, re := range e.allowlist {
+		if re.MatchString(input) {
+			decision.Reasons = []ModerationReason{{Action: ActionAllow, Pattern: e.policy.Allowlist[i]}}
+			return decision
+		}
+	}
+	for _, category := range result.names() {
+		t, ok := e.policy.Categories[category]
+		if !ok {
+			t = e.policy.Default
+		}
+		score := result.CategoryScores.Get(category)
+		switch {
+		case t.Block > 0 && score >= t.Block:
+			decision.add(ModerationReason{Action: ActionBlock, Category: category, Score: score, Threshold: t.Block})
+		case t.Warn > 0 && score >= t.Warn:
+			decision.add(ModerationReason{Action: ActionWarn, Category: category, Score: score, Threshold: t.Warn})
+		}
+	}
+	if result.Flagged && e.policy.Flagged != "" {
+		decision.add(ModerationReason{Action: e.policy.Flagged, Flagged: true})
+	}
+	return decision
+}
+
+// add adds the reason and raises the action of the decision to the action of
+// the reason.
+func (d *ModerationDecision) add(reason ModerationReason) {
+	d.Reasons = append(d.Reasons, reason)
+	if reason.Action.severity() > d.Action.severity() {
+		d.Action = reason.Action
+	}
+}
@@ -0,0 +1,87 @@
+package openai_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/openaitest"
+)
+
+func TestModerationEngine(t *testing.T) {
+	t.Parallel()
+	var scored openai.ModerationResult
+	if err := json.Unmarshal([]byte(moderationResult), &scored); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	fake := openaitest.NewFake().Handle(openai.OperationModeration, func(ctx context.Context, request any) (any, error) {
+		req := request.(openai.ModerationRequest)
+		resp := &openai.ModerationResponse{}
+		for _, input := range req.Input {
+			if input == "clean" {
+				resp.Results = append(resp.Results, openai.ModerationResult{})
+			} else {
+				resp.Results = append(resp.Results, scored)
+			}
+		}
+		return resp, nil
+	})
+	engine, err := openai.NewModerationEngine(fake, openai.ModerationPolicy{
+		Categories: map[string]openai.CategoryThresholds{
+			openai.CategoryHarassment:     {Warn: 0.5, Block: 0.8},
+			openai.CategorySelfHarmIntent: {Block: 0.95},
+		},
+		Default:   openai.CategoryThresholds{Block: 0.99},
+		Flagged:   openai.ActionWarn,
+		Allowlist: []string{`(?i)quote: mean`},
+	})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+
+	decisions, err := engine.Moderate(context.Background(), openai.ModerationRequest{Input: []string{"clean", "mean", "Quote: mean", "quote: mean and worse"}})
+	if err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if d := decisions[0]; d.Action != openai.ActionAllow || len(d.Reasons) != 0 {
+		t.Errorf("Expected allow without reasons, got %#v", d)
+	}
+	d := decisions[1]
+	if d.Action != openai.ActionWarn || len(d.Reasons) != 2 {
+		t.Fatalf("Expected warning with 2 reasons, got %#v", d)
+	}
+	if r := d.Reasons[0]; r.Category != openai.CategoryHarassment || r.Action != openai.ActionWarn || r.Threshold != 0.5 {
+		t.Errorf("Expected harassment warning, got %#v", r)
+	}
+	if r := d.Reasons[1]; !r.Flagged || r.String() != "warn: text flagged by the moderation API" {
+		t.Errorf("Expected flagged warning, got %v", r)
+	}
+	if d := decisions[2]; d.Action != openai.ActionAllow || len(d.Reasons) != 1 || d.Reasons[0].Pattern == "" {
+		t.Errorf("Expected allowlisted text, got %#v", d)
+	}
+	if d := decisions[3]; d.Action != openai.ActionWarn {
+		t.Errorf("Expected text only starting with an allowlisted text to be moderated, got %#v", d)
+	}
+
+	scored.CategoryScores.Harassment = 0.85
+	d = engine.Evaluate("mean", scored)
+	if d.Action != openai.ActionBlock || d.Reasons[0].String() != "block: harassment score 0.8500 reached threshold 0.8000" {
+		t.Errorf("Expected harassment block, got %#v", d)
+	}
+}
+
+func TestModerationEngineInvalidPolicy(t *testing.T) {
+	t.Parallel()
+	policies := []openai.ModerationPolicy{
+		{Default: openai.CategoryThresholds{Warn: 2}},
+		{Flagged: "ignore"},
+		{Allowlist: []string{"("}},
+		{Categories: map[string]openai.CategoryThresholds{"harrassment": {Block: 0.5}}},
+	}
+	for _, policy := range policies {
+		if _, err := openai.NewModerationEngine(nil, policy); err == nil {
+			t.Errorf("Expected error for %#v, got nil", policy)
+		}
+	}
+}
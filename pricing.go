@@ -0,0 +1,109 @@
+package openai
+
+import "strings"
+
+// imageModel is the model name under which image generations, variations and
+// edits are accounted. The images API does not take a model parameter.
+const imageModel = "dall-e"
+
+// ModelPrice is the price of a text model in US dollars per 1000 tokens.
+type ModelPrice struct {
+	// Prompt is the price per 1000 prompt tokens.
+	Prompt float64 `json:"prompt" yaml:"prompt"`
+	// Completion is the price per 1000 completion tokens.
+	Completion float64 `json:"completion" yaml:"completion"`
+}
+
+// Pricing is a price table used to estimate the cost of requests.
+type Pricing struct {
+	// Models maps model names to their token prices. A model that is not
+	// found by its exact name is looked up by the longest key that is a
+	// prefix of its name, so fine-tuned models like "davinci:ft-acme" are
+	// priced as their base model. Models that are not found have no price:
+	// Cost counts them as free, but budget trackers with cost limits refuse
+	// requests to them.
+	Models map[string]ModelPrice `json:"models" yaml:"models"`
+	// Images maps image sizes to the price of a single image.
+	Images map[ImageSize]float64 `json:"images" yaml:"images"`
+}
+
+// DefaultPricing is the OpenAI list price table. See
+// https://openai.com/api/pricing/
+var DefaultPricing = Pricing{
+	Models: map[string]ModelPrice{
+		"ada":                    {Prompt: 0.0004, Completion: 0.0004},
+		"babbage":                {Prompt: 0.0005, Completion: 0.0005},
+		"curie":                  {Prompt: 0.002, Completion: 0.002},
+		"davinci":                {Prompt: 0.02, Completion: 0.02},
+		"text-ada-001":           {Prompt: 0.0004, Completion: 0.0004},
+		"text-babbage-001":       {Prompt: 0.0005, Completion: 0.0005},
+		"text-curie-001":         {Prompt: 0.002, Completion: 0.002},
+		"text-davinci-002":       {Prompt: 0.02, Completion: 0.02},
+		"text-davinci-003":       {Prompt: 0.02, Completion: 0.02},
+		"gpt-3.5-turbo":          {Prompt: 0.002, Completion: 0.002},
+		"text-davinci-edit-001":  {},
+		"code-davinci-edit-001":  {},
+		"text-moderation-stable": {},
+		"text-moderation-latest": {},
+		"text-moderation":        {},
+		"omni-moderation":        {},
+	},
+	Images: map[ImageSize]float64{
+		SmallImage:  0.016,
+		MediumImage: 0.018,
+		LargeImage:  0.020,
+	},
+}
+
+// modelPrice returns the price of the model and whether it was found.
+func (p Pricing) modelPrice(model string) (ModelPrice, bool) {
+	if price, ok := p.Models[model]; ok {
+		return price, true
+	}
+	var (
+		best  string
+		found bool
+	)
+	for name := range p.Models {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best, found = name, true
+		}
+	}
+	return p.Models[best], found
+}
+
+// priced reports whether the price table has a price for the usage record:
+// the price of its images if it has any, or else the price of its model.
+// Records without a model, e.g. moderations with the default model, are free.
+func (p Pricing) priced(rec UsageRecord) bool {
+	if rec.Images > 0 {
+		_, ok := p.Images[imageSize(rec.ImageSize)]
+		return ok
+	}
+	if rec.Model == "" {
+		return true
+	}
+	_, ok := p.modelPrice(rec.Model)
+	return ok
+}
+
+// imageSize returns the size of images accounted without a size.
+func imageSize(size ImageSize) ImageSize {
+	if size == "" {
+		return LargeImage
+	}
+	return size
+}
+
+// Cost returns the estimated cost of the usage record in US dollars.
+func (p Pricing) Cost(rec UsageRecord) float64 {
+	var cost float64
+	if price, ok := p.modelPrice(rec.Model); ok {
+		cost += float64(rec.Usage.PropmtTokens) / 1000 * price.Prompt
+		cost += float64(rec.Usage.CompletionTokens) / 1000 * price.Completion
+	}
+	if rec.Images > 0 {
+		cost += float64(rec.Images) * p.Images[imageSize(rec.ImageSize)]
+	}
+	return cost
+}
@@ -0,0 +1,166 @@
+// Package promopenai exports metrics of the OpenAI API client to Prometheus.
+//
+// Register a Collector with a Prometheus registry and add its middleware to
+// the clients to observe:
+//
+//	collector := promopenai.NewCollector()
+//	prometheus.MustRegister(collector)
+//	client := openai.NewOpenAI(apiKey, openai.WithMiddleware(collector.Middleware()))
+package promopenai
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/noclue/openai"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// namespace is the prefix of the metric names.
+const namespace = "openai"
+
+// rateLimitHeaders maps the rate limit kinds to the response headers
+// reporting the remaining requests or tokens and the limits.
+var rateLimitHeaders = map[string][2]string{
+	"requests": {"X-Ratelimit-Remaining-Requests", "X-Ratelimit-Limit-Requests"},
+	"tokens":   {"X-Ratelimit-Remaining-Tokens", "X-Ratelimit-Limit-Tokens"},
+}
+
+// Collector collects metrics of the calls made by OpenAI API clients. It
+// implements prometheus.Collector.
+type Collector struct {
+	requests           *prometheus.CounterVec
+	duration           *prometheus.HistogramVec
+	retries            *prometheus.CounterVec
+	tokens             *prometheus.CounterVec
+	images             *prometheus.CounterVec
+	rateLimitRemaining *prometheus.GaugeVec
+	rateLimitLimit     *prometheus.GaugeVec
+}
+
+// NewCollector creates a collector.
+func NewCollector() *Collector {
+	return &Collector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Number of calls to the OpenAI API by operation, endpoint, model and HTTP status. The status is \"cache_hit\" for calls answered from the client's cache, which have no endpoint, and \"error\" for other calls without an HTTP response.",
+		}, []string{"operation", "endpoint", "model", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of calls to the OpenAI API by operation, endpoint and model.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120},
+		}, []string{"operation", "endpoint", "model"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retries_total",
+			Help:      "Number of HTTP requests to the OpenAI API beyond the first of each call by operation and endpoint.",
+		}, []string{"operation", "endpoint"}),
+		tokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tokens_total",
+			Help:      "Number of tokens consumed by model and type (prompt or completion).",
+		}, []string{"model", "type"}),
+		images: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "images_total",
+			Help:      "Number of generated images by operation and size.",
+		}, []string{"operation", "size"}),
+		rateLimitRemaining: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ratelimit_remaining",
+			Help:      "Remaining requests or tokens in the current rate limit window as of the last response, by model and kind.",
+		}, []string{"model", "kind"}),
+		rateLimitLimit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ratelimit_limit",
+			Help:      "Rate limit of requests or tokens as of the last response, by model and kind.",
+		}, []string{"model", "kind"}),
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.requests, c.duration, c.retries, c.tokens, c.images,
+		c.rateLimitRemaining, c.rateLimitLimit,
+	}
+}
+
+// Describe sends the descriptors of the collected metrics to ch.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range c.collectors() {
+		collector.Describe(ch)
+	}
+}
+
+// Collect sends the collected metrics to ch.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, collector := range c.collectors() {
+		collector.Collect(ch)
+	}
+}
+
+// Middleware returns middleware that records the metrics of the calls passing
+// through it. The same collector may be used by several clients.
+func (c *Collector) Middleware() openai.Middleware {
+	return func(next openai.Handler) openai.Handler {
+		return func(ctx context.Context, call *openai.Call) error {
+			start := time.Now()
+			err := next(ctx, call)
+			c.observe(call, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// observe records the metrics of the call. Calls answered from the client's
+// cache are only counted: they send no request and consume no tokens.
+func (c *Collector) observe(call *openai.Call, elapsed time.Duration, err error) {
+	model := call.Model()
+	if call.CacheHit {
+		c.requests.WithLabelValues(call.Operation, call.Endpoint, model, "cache_hit").Inc()
+		return
+	}
+	status := "error"
+	if call.StatusCode != 0 {
+		status = strconv.Itoa(call.StatusCode)
+	}
+	c.requests.WithLabelValues(call.Operation, call.Endpoint, model, status).Inc()
+	c.duration.WithLabelValues(call.Operation, call.Endpoint, model).Observe(elapsed.Seconds())
+	if call.Attempts > 1 {
+		c.retries.WithLabelValues(call.Operation, call.Endpoint).Add(float64(call.Attempts - 1))
+	}
+	for kind, headers := range rateLimitHeaders {
+		if v, err := strconv.ParseFloat(call.Header.Get(headers[0]), 64); err == nil {
+			c.rateLimitRemaining.WithLabelValues(model, kind).Set(v)
+		}
+		if v, err := strconv.ParseFloat(call.Header.Get(headers[1]), 64); err == nil {
+			c.rateLimitLimit.WithLabelValues(model, kind).Set(v)
+		}
+	}
+	if err != nil {
+		return
+	}
+	rec, ok := call.Usage()
+	if !ok {
+		return
+	}
+	if rec.Model != "" {
+		model = rec.Model
+	}
+	if rec.Usage.PropmtTokens > 0 {
+		c.tokens.WithLabelValues(model, "prompt").Add(float64(rec.Usage.PropmtTokens))
+	}
+	if rec.Usage.CompletionTokens > 0 {
+		c.tokens.WithLabelValues(model, "completion").Add(float64(rec.Usage.CompletionTokens))
+	}
+	if rec.Images > 0 {
+		size := string(rec.ImageSize)
+		if size == "" {
+			size = string(openai.LargeImage)
+		}
+		c.images.WithLabelValues(call.Operation, size).Add(float64(rec.Images))
+	}
+}
@@ -0,0 +1,136 @@
+package promopenai_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noclue/openai"
+	"github.com/noclue/openai/promopenai"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const (
+	apiKey = "sk-12345"
+
+	completionsResponse = `{
+		"id": "cmpl-1",
+		"model": "text-davinci-003",
+		"choices": [{"text": "blah-blah", "index": 0, "finish_reason": "stop"}],
+		"usage": {"prompt_tokens": 5, "completion_tokens": 7, "total_tokens": 12}
+	}`
+	imageResponse = `{"created": 1632632576, "data": [{"url": "https://example.com/1"}, {"url": "https://example.com/2"}]}`
+)
+
+type mockHttpClient struct {
+	body string
+}
+
+func (m *mockHttpClient) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(m.body)),
+		Header: http.Header{
+			"Content-Type":                   []string{"application/json"},
+			"X-Ratelimit-Remaining-Requests": []string{"59"},
+			"X-Ratelimit-Limit-Requests":     []string{"60"},
+			"X-Ratelimit-Remaining-Tokens":   []string{"149988"},
+		},
+	}, nil
+}
+
+func TestCollector(t *testing.T) {
+	t.Parallel()
+	collector := promopenai.NewCollector()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+
+	completions := openai.NewOpenAI(apiKey,
+		openai.WithHttpClient(&mockHttpClient{body: completionsResponse}),
+		openai.WithMiddleware(collector.Middleware()))
+	for i := 0; i < 2; i++ {
+		if _, err := completions.CreateCompletion(context.Background(), openai.CompletionsRequest{
+			Model:  "text-davinci-003",
+			Prompt: "blah-blah",
+		}); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+	}
+	images := openai.NewOpenAI(apiKey,
+		openai.WithHttpClient(&mockHttpClient{body: imageResponse}),
+		openai.WithMiddleware(collector.Middleware()))
+	if _, err := images.CreateImage(context.Background(), openai.CreateImageReq{
+		Prompt:         "This is a test",
+		CommonImageReq: openai.CommonImageReq{Size: openai.SmallImage},
+	}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+
+	expected := `
+# HELP openai_requests_total Number of calls to the OpenAI API by operation, endpoint, model and HTTP status. The status is "cache_hit" for calls answered from the client's cache, which have no endpoint, and "error" for other calls without an HTTP response.
+# TYPE openai_requests_total counter
+openai_requests_total{endpoint="/v1/completions",model="text-davinci-003",operation="CreateCompletion",status="200"} 2
+openai_requests_total{endpoint="/v1/images/generations",model="dall-e",operation="CreateImage",status="200"} 1
+# HELP openai_tokens_total Number of tokens consumed by model and type (prompt or completion).
+# TYPE openai_tokens_total counter
+openai_tokens_total{model="text-davinci-003",type="completion"} 14
+openai_tokens_total{model="text-davinci-003",type="prompt"} 10
+# HELP openai_images_total Number of generated images by operation and size.
+# TYPE openai_images_total counter
+openai_images_total{operation="CreateImage",size="256x256"} 2
+# HELP openai_ratelimit_remaining Remaining requests or tokens in the current rate limit window as of the last response, by model and kind.
+# TYPE openai_ratelimit_remaining gauge
+openai_ratelimit_remaining{kind="requests",model="dall-e"} 59
+openai_ratelimit_remaining{kind="requests",model="text-davinci-003"} 59
+openai_ratelimit_remaining{kind="tokens",model="dall-e"} 149988
+openai_ratelimit_remaining{kind="tokens",model="text-davinci-003"} 149988
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"openai_requests_total", "openai_tokens_total", "openai_images_total", "openai_ratelimit_remaining"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(collector, "openai_request_duration_seconds"); n != 2 {
+		t.Errorf("Expected 2 latency histograms, got %d", n)
+	}
+}
+
+func TestCollectorCacheHits(t *testing.T) {
+	t.Parallel()
+	collector := promopenai.NewCollector()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+
+	client := openai.NewOpenAI(apiKey,
+		openai.WithHttpClient(&mockHttpClient{body: completionsResponse}),
+		openai.WithCache(openai.NewMemoryCache(10), time.Hour),
+		openai.WithMiddleware(collector.Middleware()))
+	zero := 0.0
+	for i := 0; i < 2; i++ {
+		if _, err := client.CreateCompletion(context.Background(), openai.CompletionsRequest{
+			Model:       "text-davinci-003",
+			Prompt:      "blah-blah",
+			Temperature: &zero,
+		}); err != nil {
+			t.Fatalf("Expected nil, got %#v", err)
+		}
+	}
+
+	expected := `
+# HELP openai_requests_total Number of calls to the OpenAI API by operation, endpoint, model and HTTP status. The status is "cache_hit" for calls answered from the client's cache, which have no endpoint, and "error" for other calls without an HTTP response.
+# TYPE openai_requests_total counter
+openai_requests_total{endpoint="",model="text-davinci-003",operation="CreateCompletion",status="cache_hit"} 1
+openai_requests_total{endpoint="/v1/completions",model="text-davinci-003",operation="CreateCompletion",status="200"} 1
+# HELP openai_tokens_total Number of tokens consumed by model and type (prompt or completion).
+# TYPE openai_tokens_total counter
+openai_tokens_total{model="text-davinci-003",type="completion"} 7
+openai_tokens_total{model="text-davinci-003",type="prompt"} 5
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"openai_requests_total", "openai_tokens_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,145 @@
+package openai
+
+import "unicode/utf8"
+
+// defaultMaxTokens is the number of tokens the completions endpoint generates
+// when max_tokens is not set.
+const defaultMaxTokens = 16
+
+// bytesPerToken is the average number of characters of English text per
+// token of GPT tokenizers.
+const bytesPerToken = 4
+
+// estimateTokens returns a rough estimate of the number of tokens in s. ASCII
+// characters count bytesPerToken to a token and other characters, which GPT
+// tokenizers rarely merge, a token each.
+func estimateTokens(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return tokenCount(ascii, other)
+}
+
+// tokenCount returns the estimated number of tokens of a text with the numbers
+// of ASCII and other characters.
+func tokenCount(ascii, other int) int {
+	return (ascii+bytesPerToken-1)/bytesPerToken + other
+}
+
+// tokenPrefix returns the length in bytes of the longest prefix of s of at
+// most n estimated tokens.
+func tokenPrefix(s string, n int) int {
+	ascii, other := 0, 0
+	for i, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+		if tokenCount(ascii, other) > n {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// tokenSuffix returns the length in bytes of the longest suffix of s of at
+// most n estimated tokens.
+func tokenSuffix(s string, n int) int {
+	ascii, other := 0, 0
+	for end := len(s); end > 0; {
+		r, size := utf8.DecodeLastRuneInString(s[:end])
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+		if tokenCount(ascii, other) > n {
+			return len(s) - end
+		}
+		end -= size
+	}
+	return len(s)
+}
+
+// completionEstimate returns the estimated usage of a completions request
+// before it is sent.
+func completionEstimate(req CompletionsRequest) UsageRecord {
+	prompt := estimateTokens(req.Prompt) + estimateTokens(req.Suffix)
+	maxTokens := defaultMaxTokens
+	if req.MaxTokens != nil {
+		maxTokens = *req.MaxTokens
+	}
+	n := 1
+	if req.N != nil {
+		n = *req.N
+	}
+	if req.BestOf != nil && *req.BestOf > n {
+		n = *req.BestOf
+	}
+	return UsageRecord{
+		Model: req.Model,
+		User:  req.User,
+		Usage: Usage{
+			PropmtTokens:     prompt,
+			CompletionTokens: maxTokens * n,
+			TotalTokens:      prompt + maxTokens*n,
+		},
+	}
+}
+
+// editEstimate returns the estimated usage of an edits request before it is
+// sent. The edited text is assumed to be as long as the input.
+func editEstimate(req EditRequest) UsageRecord {
+	prompt := estimateTokens(req.Input) + estimateTokens(req.Instruction)
+	n := 1
+	if req.N != nil {
+		n = *req.N
+	}
+	completion := estimateTokens(req.Input) * n
+	return UsageRecord{
+		Model: req.Model,
+		Usage: Usage{
+			PropmtTokens:     prompt,
+			CompletionTokens: completion,
+			TotalTokens:      prompt + completion,
+		},
+	}
+}
+
+// imageEstimate returns the estimated usage of an images request before it is
+// sent.
+func imageEstimate(req CommonImageReq) UsageRecord {
+	n := 1
+	if req.N != nil {
+		n = *req.N
+	}
+	return UsageRecord{
+		Model:     imageModel,
+		User:      req.User,
+		Images:    n,
+		ImageSize: req.Size,
+	}
+}
+
+// estimateUsage returns the estimated usage of a call before it is sent and
+// whether the call has usage to estimate.
+func estimateUsage(call *Call) (UsageRecord, bool) {
+	switch req := call.Request.(type) {
+	case *CompletionsRequest:
+		return completionEstimate(*req), true
+	case *EditRequest:
+		return editEstimate(*req), true
+	case *ModerationRequest:
+		return UsageRecord{Model: req.Model}, true
+	case *CreateImageReq, *CreateImageVariationsReq, *CreateImageEditsReq:
+		return imageEstimate(imageRequest(call)), true
+	default:
+		return UsageRecord{}, false
+	}
+}
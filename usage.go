@@ -0,0 +1,216 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// UsageRecord is the usage of a single request to the OpenAI API.
+type UsageRecord struct {
+	// Model is the model that served the request.
+	Model string
+	// User is the end-user identifier sent with the request, if any.
+	User string
+	// Tags are the caller defined tags attached with WithUsageTags.
+	Tags []string
+	// Usage is the token usage reported by the API.
+	Usage Usage
+	// Images is the number of generated images.
+	Images int
+	// ImageSize is the size of the generated images.
+	ImageSize ImageSize
+}
+
+// UsageTotals is the accumulated usage of a group of requests.
+type UsageTotals struct {
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Images           int64   `json:"images"`
+	Cost             float64 `json:"estimated_cost_usd"`
+}
+
+func (t *UsageTotals) add(rec UsageRecord, cost float64) {
+	t.Requests++
+	t.PromptTokens += int64(rec.Usage.PropmtTokens)
+	t.CompletionTokens += int64(rec.Usage.CompletionTokens)
+	t.TotalTokens += int64(rec.Usage.TotalTokens)
+	t.Images += int64(rec.Images)
+	t.Cost += cost
+}
+
+// UsageSnapshot is a point in time copy of the usage accumulated by a
+// UsageAccountant.
+type UsageSnapshot struct {
+	// Since is the time the accountant was created or last reset.
+	Since time.Time `json:"since"`
+	// Taken is the time the snapshot was taken.
+	Taken time.Time `json:"taken"`
+	// Total is the usage of all requests.
+	Total UsageTotals `json:"total"`
+	// ByModel is the usage per model.
+	ByModel map[string]UsageTotals `json:"by_model"`
+	// ByUser is the usage per end-user. Requests without a user are not
+	// included.
+	ByUser map[string]UsageTotals `json:"by_user"`
+	// ByTag is the usage per tag. A request with several tags is counted
+	// once for each of them.
+	ByTag map[string]UsageTotals `json:"by_tag"`
+}
+
+// UsageAccountant accumulates token usage, image counts and estimated costs of
+// the requests made by a client. It is safe for concurrent use. Attach it to a
+// client with WithUsageAccountant.
+type UsageAccountant struct {
+	mu      sync.Mutex
+	pricing Pricing
+	since   time.Time
+	total   UsageTotals
+	byModel map[string]UsageTotals
+	byUser  map[string]UsageTotals
+	byTag   map[string]UsageTotals
+}
+
+// NewUsageAccountant creates a usage accountant that estimates costs with the
+// given price table.
+func NewUsageAccountant(pricing Pricing) *UsageAccountant {
+	a := &UsageAccountant{pricing: pricing}
+	a.Reset()
+	return a
+}
+
+// Record adds the usage record to the accumulated usage and returns its
+// estimated cost in US dollars.
+func (a *UsageAccountant) Record(rec UsageRecord) float64 {
+	cost := a.pricing.Cost(rec)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.total.add(rec, cost)
+	addTotals(a.byModel, rec.Model, rec, cost)
+	if rec.User != "" {
+		addTotals(a.byUser, rec.User, rec, cost)
+	}
+	for _, tag := range rec.Tags {
+		addTotals(a.byTag, tag, rec, cost)
+	}
+	return cost
+}
+
+func addTotals(m map[string]UsageTotals, key string, rec UsageRecord, cost float64) {
+	t := m[key]
+	t.add(rec, cost)
+	m[key] = t
+}
+
+// Snapshot returns a copy of the accumulated usage.
+func (a *UsageAccountant) Snapshot() UsageSnapshot {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return UsageSnapshot{
+		Since:   a.since,
+		Taken:   time.Now(),
+		Total:   a.total,
+		ByModel: copyTotals(a.byModel),
+		ByUser:  copyTotals(a.byUser),
+		ByTag:   copyTotals(a.byTag),
+	}
+}
+
+func copyTotals(m map[string]UsageTotals) map[string]UsageTotals {
+	res := make(map[string]UsageTotals, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
+
+// WriteJSON writes a snapshot of the accumulated usage as JSON to w.
+func (a *UsageAccountant) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a.Snapshot())
+}
+
+// Reset discards the accumulated usage.
+func (a *UsageAccountant) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.since = time.Now()
+	a.total = UsageTotals{}
+	a.byModel = map[string]UsageTotals{}
+	a.byUser = map[string]UsageTotals{}
+	a.byTag = map[string]UsageTotals{}
+}
+
+type usageTagsKey struct{}
+
+// WithUsageTags returns a context that attributes the usage of requests made
+// with it to the given tags, in addition to any tags already in ctx.
+func WithUsageTags(ctx context.Context, tags ...string) context.Context {
+	existing := usageTags(ctx)
+	all := make([]string, 0, len(existing)+len(tags))
+	all = append(all, existing...)
+	all = append(all, tags...)
+	return context.WithValue(ctx, usageTagsKey{}, all)
+}
+
+func usageTags(ctx context.Context) []string {
+	tags, _ := ctx.Value(usageTagsKey{}).([]string)
+	return tags
+}
+
+// recordUsage records the usage of a request with the client's accountant, and
+// with the budget tracker by settling the budget reservation of the request if
+// it has one. Failures to persist budget spend do not fail the request, whose
+// response has been received and paid for; they are logged with the client's
+// logger, or the default logger if there is none, and the spend is persisted
+// again with the next request.
+func (o *openAI) recordUsage(ctx context.Context, reservation *BudgetReservation, rec UsageRecord) {
+	rec.Tags = usageTags(ctx)
+	if o.usage != nil {
+		o.usage.Record(rec)
+	}
+	if reservation == nil {
+		return
+	}
+	if err := reservation.Record(rec); err != nil {
+		logger := o.logger
+		if logger == nil {
+			logger = slog.Default()
+		}
+		logger.LogAttrs(ctx, slog.LevelError, "openai budget spend not persisted", slog.String("error", err.Error()))
+	}
+}
+
+// callUsage returns the usage of a successful call and whether the call has
+// usage to record.
+func callUsage(call *Call) (UsageRecord, bool) {
+	switch resp := call.Response.(type) {
+	case *CompletionsResponse:
+		req := call.Request.(*CompletionsRequest)
+		model := resp.Model
+		if model == "" {
+			model = req.Model
+		}
+		return UsageRecord{Model: model, User: req.User, Usage: resp.Usage}, true
+	case *EditResponse:
+		return UsageRecord{Model: call.Request.(*EditRequest).Model, Usage: resp.Usage}, true
+	case *ModerationResponse:
+		return UsageRecord{Model: resp.Model}, true
+	case *ImageResponse:
+		req := imageRequest(call)
+		return UsageRecord{
+			Model:     imageModel,
+			User:      req.User,
+			Images:    len(resp.Data),
+			ImageSize: req.Size,
+		}, true
+	default:
+		return UsageRecord{}, false
+	}
+}
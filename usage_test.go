@@ -0,0 +1,148 @@
+package openai_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/noclue/openai"
+)
+
+const completionsSuccessResponse = `{
+	"id": "cmpl-1",
+	"object": "text_completion",
+	"created": 1632632576,
+	"model": "text-davinci-003",
+	"choices": [
+		{
+			"text": "blah-blah",
+			"index": 0,
+			"finish_reason": "stop"
+		}
+	],
+	"usage": {
+		"prompt_tokens": 500,
+		"completion_tokens": 1500,
+		"total_tokens": 2000
+	}
+}`
+
+func jsonResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header: http.Header{
+			"Content-Type": []string{"application/json"},
+		},
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestPricingCost(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		rec  openai.UsageRecord
+		want float64
+	}{
+		{"exact model", openai.UsageRecord{Model: "text-davinci-003", Usage: openai.Usage{PropmtTokens: 1000, CompletionTokens: 1000}}, 0.04},
+		{"fine-tuned model priced as base", openai.UsageRecord{Model: "curie:ft-acme-2023", Usage: openai.Usage{PropmtTokens: 1000}}, 0.002},
+		{"unknown model is free", openai.UsageRecord{Model: "unknown", Usage: openai.Usage{PropmtTokens: 1000}}, 0},
+		{"images", openai.UsageRecord{Model: "dall-e", Images: 2, ImageSize: openai.SmallImage}, 0.032},
+		{"images default size", openai.UsageRecord{Model: "dall-e", Images: 1}, 0.02},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := openai.DefaultPricing.Cost(tt.rec); !almostEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUsageAccountant(t *testing.T) {
+	t.Parallel()
+	accountant := openai.NewUsageAccountant(openai.DefaultPricing)
+
+	completions := openai.NewOpenAI(apiKey,
+		openai.WithHttpClient(&mockHttpClient{response: jsonResponse(http.StatusOK, completionsSuccessResponse)}),
+		openai.WithUsageAccountant(accountant))
+	ctx := openai.WithUsageTags(context.Background(), "eval")
+	if _, err := completions.CreateCompletion(ctx, openai.CompletionsRequest{
+		Model:  "text-davinci-003",
+		Prompt: "blah-blah",
+		User:   "user-1",
+	}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+
+	images := openai.NewOpenAI(apiKey,
+		openai.WithHttpClient(&mockHttpClient{response: jsonResponse(http.StatusOK, successResponse)}),
+		openai.WithUsageAccountant(accountant))
+	if _, err := images.CreateImage(context.Background(), openai.CreateImageReq{
+		Prompt:         "This is a test",
+		CommonImageReq: openai.CommonImageReq{Size: openai.MediumImage},
+	}); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+
+	failing := openai.NewOpenAI(apiKey,
+		openai.WithHttpClient(&mockHttpClient{response: jsonResponse(http.StatusBadRequest, errInvalidToken)}),
+		openai.WithUsageAccountant(accountant))
+	if _, err := failing.CreateImage(context.Background(), openai.CreateImageReq{Prompt: "This is a test"}); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	snapshot := accountant.Snapshot()
+	if snapshot.Total.Requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", snapshot.Total.Requests)
+	}
+	if snapshot.Total.TotalTokens != 2000 {
+		t.Errorf("Expected 2000 tokens, got %d", snapshot.Total.TotalTokens)
+	}
+	if snapshot.Total.Images != 1 {
+		t.Errorf("Expected 1 image, got %d", snapshot.Total.Images)
+	}
+	if !almostEqual(snapshot.Total.Cost, 0.058) {
+		t.Errorf("Expected cost 0.058, got %v", snapshot.Total.Cost)
+	}
+	if !almostEqual(snapshot.ByModel["text-davinci-003"].Cost, 0.04) {
+		t.Errorf("Expected text-davinci-003 cost 0.04, got %v", snapshot.ByModel["text-davinci-003"].Cost)
+	}
+	if snapshot.ByModel["dall-e"].Images != 1 {
+		t.Errorf("Expected 1 dall-e image, got %d", snapshot.ByModel["dall-e"].Images)
+	}
+	if snapshot.ByUser["user-1"].Requests != 1 {
+		t.Errorf("Expected 1 request for user-1, got %d", snapshot.ByUser["user-1"].Requests)
+	}
+	if snapshot.ByTag["eval"].PromptTokens != 500 {
+		t.Errorf("Expected 500 prompt tokens for tag eval, got %d", snapshot.ByTag["eval"].PromptTokens)
+	}
+
+	var buf bytes.Buffer
+	if err := accountant.WriteJSON(&buf); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	var exported openai.UsageSnapshot
+	if err := json.Unmarshal(buf.Bytes(), &exported); err != nil {
+		t.Fatalf("Expected nil, got %#v", err)
+	}
+	if exported.Total.Requests != 2 {
+		t.Errorf("Expected 2 exported requests, got %d", exported.Total.Requests)
+	}
+
+	accountant.Reset()
+	if accountant.Snapshot().Total.Requests != 0 {
+		t.Error("Expected no requests after reset")
+	}
+}